@@ -7,3 +7,15 @@ require github.com/google/uuid v1.6.0
 require github.com/golang-jwt/jwt/v5 v5.3.1
 
 require github.com/ledongthuc/pdf v0.0.0-20250511090121-5959a4027728
+
+require github.com/jackc/pgx/v5 v5.11.0
+
+require golang.org/x/net v0.45.0
+
+require (
+	github.com/jackc/pgpassfile v1.0.0 // indirect
+	github.com/jackc/pgservicefile v0.0.0-20240606120523-5a60cdf6a761 // indirect
+	github.com/jackc/puddle/v2 v2.2.2 // indirect
+	golang.org/x/sync v0.17.0 // indirect
+	golang.org/x/text v0.29.0 // indirect
+)
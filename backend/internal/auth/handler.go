@@ -1,6 +1,7 @@
 package auth
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
 	"os"
@@ -57,6 +58,15 @@ type Claims struct {
 	jwt.RegisteredClaims
 }
 
+type usernameKey struct{}
+
+// Username returns the user authenticated by Middleware for the request
+// context, or "" if there is none.
+func Username(ctx context.Context) string {
+	username, _ := ctx.Value(usernameKey{}).(string)
+	return username
+}
+
 // RegisterRoutes registers the auth routes on the mux.
 func (h *Handler) RegisterRoutes(mux *http.ServeMux) {
 	mux.HandleFunc("/api/login", h.Login)
@@ -124,6 +134,6 @@ func (h *Handler) Middleware(next http.HandlerFunc) http.HandlerFunc {
 			return
 		}
 
-		next(w, r)
+		next(w, r.WithContext(context.WithValue(r.Context(), usernameKey{}, claims.Username)))
 	}
 }
@@ -0,0 +1,131 @@
+package document
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/akhilmk/gowise/internal/resilient"
+)
+
+// Blob store backends selectable via BLOB_STORE.
+const (
+	BlobStoreLocal = "local"
+	BlobStoreS3    = "s3"
+)
+
+var errBlobNotFound = errors.New("file not found")
+
+// BlobStore keeps the original uploaded files, one blob per document.
+type BlobStore interface {
+	// Put stores the file at path under key, replacing any existing blob.
+	Put(ctx context.Context, key, path string) error
+	// Get opens the blob stored under key and returns its size, or -1 if
+	// unknown. It fails with errBlobNotFound if there is none.
+	Get(ctx context.Context, key string) (io.ReadCloser, int64, error)
+	// Delete removes the blob stored under key. Missing blobs are ignored.
+	Delete(ctx context.Context, key string) error
+}
+
+// newBlobStore creates the BlobStore selected by cfg.BlobStore.
+func newBlobStore(cfg Config) (BlobStore, error) {
+	switch cfg.BlobStore {
+	case BlobStoreLocal:
+		return NewLocalBlobStore(cfg.BlobStoreDir)
+	case BlobStoreS3:
+		// Originals can be large; only waiting for S3 to answer is timed
+		blobHTTP := cfg.HTTP
+		blobHTTP.HeaderTimeout = blobHTTP.Timeout
+		return NewS3BlobStore(cfg.S3Endpoint, cfg.S3Region, cfg.S3Bucket, cfg.S3AccessKey, cfg.S3SecretKey, resilient.New("s3", blobHTTP))
+	default:
+		return nil, fmt.Errorf("unknown blob store %q", cfg.BlobStore)
+	}
+}
+
+// validBlobKey rejects keys that could escape a directory or bucket prefix.
+func validBlobKey(key string) error {
+	if key == "" || key == "." || key == ".." || strings.ContainsAny(key, `/\`) {
+		return fmt.Errorf("invalid blob key %q", key)
+	}
+	return nil
+}
+
+// LocalBlobStore keeps blobs as files in a directory.
+type LocalBlobStore struct {
+	dir string
+}
+
+func NewLocalBlobStore(dir string) (*LocalBlobStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create blob store directory %s: %w", dir, err)
+	}
+	return &LocalBlobStore{dir: dir}, nil
+}
+
+func (s *LocalBlobStore) Put(ctx context.Context, key, path string) error {
+	if err := validBlobKey(key); err != nil {
+		return err
+	}
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	// Copy to a temp file first so a crash never leaves a truncated blob
+	tmp, err := os.CreateTemp(s.dir, "."+key+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %w", err)
+	}
+	tmpName := tmp.Name()
+	defer os.Remove(tmpName) // no-op once renamed
+
+	if _, err := io.Copy(tmp, src); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write %s: %w", tmpName, err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to sync %s: %w", tmpName, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close %s: %w", tmpName, err)
+	}
+	if err := os.Rename(tmpName, filepath.Join(s.dir, key)); err != nil {
+		return fmt.Errorf("failed to rename %s: %w", tmpName, err)
+	}
+	return nil
+}
+
+func (s *LocalBlobStore) Get(ctx context.Context, key string) (io.ReadCloser, int64, error) {
+	if err := validBlobKey(key); err != nil {
+		return nil, 0, err
+	}
+	f, err := os.Open(filepath.Join(s.dir, key))
+	if os.IsNotExist(err) {
+		return nil, 0, errBlobNotFound
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, 0, err
+	}
+	return f, info.Size(), nil
+}
+
+func (s *LocalBlobStore) Delete(ctx context.Context, key string) error {
+	if err := validBlobKey(key); err != nil {
+		return err
+	}
+	if err := os.Remove(filepath.Join(s.dir, key)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,452 @@
+package document
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/akhilmk/gowise/internal/resilient"
+)
+
+const chromaAPIBase = "/api/v2/tenants/default_tenant/databases/default_database/collections"
+
+// chromaPageSize bounds how many records a single /get call returns.
+const chromaPageSize = 1000
+
+type ChromaAddRequest struct {
+	Documents  []string      `json:"documents"`
+	Metadatas  []interface{} `json:"metadatas"`
+	Ids        []string      `json:"ids"`
+	Embeddings [][]float32   `json:"embeddings"`
+}
+
+type ChromaQueryRequest struct {
+	QueryEmbeddings [][]float32            `json:"query_embeddings"`
+	NResults        int                    `json:"n_results"`
+	Where           map[string]interface{} `json:"where,omitempty"`
+}
+
+type ChromaQueryResponse struct {
+	Ids       [][]string                 `json:"ids"`
+	Documents [][]string                 `json:"documents"`
+	Metadatas [][]map[string]interface{} `json:"metadatas"`
+	Distances [][]float32                `json:"distances"`
+}
+
+type ChromaGetRequest struct {
+	Where   map[string]interface{} `json:"where,omitempty"`
+	Limit   int                    `json:"limit"`
+	Offset  int                    `json:"offset"`
+	Include []string               `json:"include"`
+}
+
+type ChromaGetResponse struct {
+	Ids       []string                 `json:"ids"`
+	Metadatas []map[string]interface{} `json:"metadatas"`
+}
+
+type ChromaUpdateRequest struct {
+	Ids       []string                 `json:"ids"`
+	Metadatas []map[string]interface{} `json:"metadatas"`
+}
+
+type ChromaDeleteRequest struct {
+	Where map[string]interface{} `json:"where"`
+}
+
+// ChromaStore is a VectorStore backed by the ChromaDB v2 REST API.
+type ChromaStore struct {
+	baseURL    string
+	collection string
+	client     *resilient.Client
+
+	mu    sync.Mutex
+	colID string // cached collection ID, resolved on first use
+}
+
+// NewChromaStore creates a store for the named collection on the Chroma
+// server at baseURL, sending requests through client. The collection is
+// created on first use.
+func NewChromaStore(baseURL, collection string, client *resilient.Client) *ChromaStore {
+	return &ChromaStore{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		collection: collection,
+		client:     client,
+	}
+}
+
+func (s *ChromaStore) Upsert(ctx context.Context, chunks []Chunk) error {
+	if len(chunks) == 0 {
+		return nil
+	}
+
+	colID, err := s.getOrCreateCollection(ctx)
+	if err != nil {
+		return fmt.Errorf("getOrCreateCollection failed: %w", err)
+	}
+
+	req := ChromaAddRequest{
+		Documents:  make([]string, 0, len(chunks)),
+		Metadatas:  make([]interface{}, 0, len(chunks)),
+		Ids:        make([]string, 0, len(chunks)),
+		Embeddings: make([][]float32, 0, len(chunks)),
+	}
+	for _, c := range chunks {
+		req.Documents = append(req.Documents, c.Text)
+		req.Metadatas = append(req.Metadatas, c.Metadata)
+		req.Ids = append(req.Ids, c.ID)
+		req.Embeddings = append(req.Embeddings, c.Embedding)
+	}
+
+	resp, err := s.post(ctx, s.collectionURL(colID, "upsert"), req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	s.checkCollectionGone(resp)
+
+	if resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("chroma upsert returned status %d: %s", resp.StatusCode, string(body))
+	}
+
+	return nil
+}
+
+func (s *ChromaStore) Query(ctx context.Context, embedding []float32, n int, where Filter) ([]QueryResult, error) {
+	colID, err := s.getOrCreateCollection(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := s.post(ctx, s.collectionURL(colID, "query"), ChromaQueryRequest{
+		QueryEmbeddings: [][]float32{embedding},
+		NResults:        n,
+		Where:           chromaWhere(where),
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	s.checkCollectionGone(resp)
+
+	if resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("chroma query returned status %d: %s", resp.StatusCode, string(body))
+	}
+
+	var res ChromaQueryResponse
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return nil, err
+	}
+
+	// One query embedding was sent, so only the first row is populated.
+	if len(res.Ids) == 0 {
+		return nil, nil
+	}
+	results := make([]QueryResult, len(res.Ids[0]))
+	for i, id := range res.Ids[0] {
+		results[i].ID = id
+		if len(res.Documents) > 0 && i < len(res.Documents[0]) {
+			results[i].Text = res.Documents[0][i]
+		}
+		if len(res.Metadatas) > 0 && i < len(res.Metadatas[0]) {
+			results[i].Metadata = res.Metadatas[0][i]
+		}
+		if len(res.Distances) > 0 && i < len(res.Distances[0]) {
+			results[i].Distance = res.Distances[0][i]
+		}
+	}
+
+	return results, nil
+}
+
+func (s *ChromaStore) Delete(ctx context.Context, where Filter) error {
+	colID, err := s.getOrCreateCollection(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get collection: %w", err)
+	}
+
+	resp, err := s.post(ctx, s.collectionURL(colID, "delete"), ChromaDeleteRequest{
+		Where: chromaWhere(where),
+	})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	s.checkCollectionGone(resp)
+
+	if resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("chroma delete error: %s", string(body))
+	}
+
+	return nil
+}
+
+func (s *ChromaStore) Count(ctx context.Context) (int, error) {
+	colID, err := s.getOrCreateCollection(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get collection: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.collectionURL(colID, "count"), nil)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get count: %w", err)
+	}
+	defer resp.Body.Close()
+	s.checkCollectionGone(resp)
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return 0, fmt.Errorf("chroma count error: %s", string(body))
+	}
+
+	var count int
+	if err := json.NewDecoder(resp.Body).Decode(&count); err != nil {
+		return 0, fmt.Errorf("failed to decode count: %w", err)
+	}
+
+	return count, nil
+}
+
+func (s *ChromaStore) ListMetadata(ctx context.Context, where Filter) ([]map[string]interface{}, error) {
+	colID, err := s.getOrCreateCollection(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get collection: %w", err)
+	}
+
+	var metadatas []map[string]interface{}
+	for offset := 0; ; offset += chromaPageSize {
+		page, err := s.getPage(ctx, colID, where, offset)
+		if err != nil {
+			return nil, err
+		}
+		metadatas = append(metadatas, page.Metadatas...)
+		if len(page.Ids) < chromaPageSize {
+			break
+		}
+	}
+
+	return metadatas, nil
+}
+
+// SetMetadata reads the matching records first and then updates them, since
+// updating while paging would shift the pages of a filter on updated fields.
+func (s *ChromaStore) SetMetadata(ctx context.Context, where Filter, values map[string]interface{}) error {
+	colID, err := s.getOrCreateCollection(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get collection: %w", err)
+	}
+
+	var records ChromaGetResponse
+	for offset := 0; ; offset += chromaPageSize {
+		page, err := s.getPage(ctx, colID, where, offset)
+		if err != nil {
+			return err
+		}
+		records.Ids = append(records.Ids, page.Ids...)
+		records.Metadatas = append(records.Metadatas, page.Metadatas...)
+		if len(page.Ids) < chromaPageSize {
+			break
+		}
+	}
+
+	for start := 0; start < len(records.Ids); start += chromaPageSize {
+		end := min(start+chromaPageSize, len(records.Ids))
+		update := ChromaUpdateRequest{Ids: records.Ids[start:end]}
+		for _, meta := range records.Metadatas[start:end] {
+			meta = copyMetadata(meta)
+			for k, v := range values {
+				meta[k] = v
+			}
+			update.Metadatas = append(update.Metadatas, meta)
+		}
+
+		resp, err := s.post(ctx, s.collectionURL(colID, "update"), update)
+		if err != nil {
+			return err
+		}
+		s.checkCollectionGone(resp)
+		if resp.StatusCode != http.StatusOK {
+			body, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			return fmt.Errorf("chroma update error: %s", string(body))
+		}
+		resp.Body.Close()
+	}
+	return nil
+}
+
+func (s *ChromaStore) getPage(ctx context.Context, colID string, where Filter, offset int) (*ChromaGetResponse, error) {
+	resp, err := s.post(ctx, s.collectionURL(colID, "get"), ChromaGetRequest{
+		Where:   chromaWhere(where),
+		Limit:   chromaPageSize,
+		Offset:  offset,
+		Include: []string{"metadatas"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	s.checkCollectionGone(resp)
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("chroma get error: %s", string(body))
+	}
+
+	var data ChromaGetResponse
+	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		return nil, fmt.Errorf("failed to decode get response: %w", err)
+	}
+
+	return &data, nil
+}
+
+func (s *ChromaStore) DropCollection(ctx context.Context) error {
+	url := fmt.Sprintf("%s%s/%s", s.baseURL, chromaAPIBase, s.collection)
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, url, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to delete collection: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNotFound {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("chroma reset error: %s", string(body))
+	}
+
+	s.forgetCollection()
+	return nil
+}
+
+func (s *ChromaStore) forgetCollection() {
+	s.mu.Lock()
+	s.colID = ""
+	s.mu.Unlock()
+}
+
+// getOrCreateCollection returns the cached collection ID, resolving it with
+// Chroma (and creating the collection) the first time it is needed.
+func (s *ChromaStore) getOrCreateCollection(ctx context.Context) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.colID != "" {
+		return s.colID, nil
+	}
+
+	id, err := s.resolveCollection(ctx)
+	if err != nil {
+		return "", err
+	}
+	s.colID = id
+	return id, nil
+}
+
+func (s *ChromaStore) resolveCollection(ctx context.Context) (string, error) {
+	// 1. Try to get
+	getURL := fmt.Sprintf("%s%s/%s", s.baseURL, chromaAPIBase, s.collection)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, getURL, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := s.client.Do(req)
+	if err == nil {
+		defer resp.Body.Close()
+		if resp.StatusCode == http.StatusOK {
+			var res struct {
+				ID string `json:"id"`
+			}
+			if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+				return "", fmt.Errorf("failed to decode get collection response: %w", err)
+			}
+			return res.ID, nil
+		}
+	}
+
+	// 2. Create if not found or status not OK
+	createURL := s.baseURL + chromaAPIBase
+	resp, err = s.post(ctx, createURL, map[string]string{"name": s.collection})
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		return "", fmt.Errorf("create collection at %s returned status %d: %s", createURL, resp.StatusCode, string(body))
+	}
+
+	var res struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(body, &res); err != nil {
+		return "", fmt.Errorf("failed to decode create collection response: %w", err)
+	}
+
+	if res.ID == "" {
+		return "", fmt.Errorf("received empty collection ID from ChromaDB")
+	}
+
+	return res.ID, nil
+}
+
+func (s *ChromaStore) collectionURL(colID, op string) string {
+	return fmt.Sprintf("%s%s/%s/%s", s.baseURL, chromaAPIBase, colID, op)
+}
+
+func (s *ChromaStore) post(ctx context.Context, url string, payload interface{}) (*http.Response, error) {
+	reqBody, _ := json.Marshal(payload)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(reqBody))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("http post to %s failed: %w", url, err)
+	}
+	return resp, nil
+}
+
+// checkCollectionGone drops the cached collection ID when Chroma reports it
+// missing, e.g. after the collection was deleted outside gowise.
+func (s *ChromaStore) checkCollectionGone(resp *http.Response) {
+	if resp.StatusCode == http.StatusNotFound {
+		s.forgetCollection()
+	}
+}
+
+// chromaWhere converts a Filter into Chroma's where syntax, which requires
+// an explicit $and when more than one field is matched.
+func chromaWhere(where Filter) map[string]interface{} {
+	switch len(where) {
+	case 0:
+		return nil
+	case 1:
+		return map[string]interface{}(where)
+	}
+
+	clauses := make([]interface{}, 0, len(where))
+	for k, v := range where {
+		clauses = append(clauses, map[string]interface{}{k: v})
+	}
+	return map[string]interface{}{"$and": clauses}
+}
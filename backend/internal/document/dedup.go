@@ -0,0 +1,48 @@
+package document
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+)
+
+// How an upload is handled when the collection already holds the same
+// document, selectable per upload via the onDuplicate form field.
+const (
+	DuplicateSkip    = "skip"    // identical content already stored: ingest nothing
+	DuplicateReplace = "replace" // remove earlier versions of the same file once ingested
+	DuplicateKeep    = "keep"    // keep earlier versions as history
+)
+
+func validDuplicateMode(mode string) bool {
+	return mode == DuplicateSkip || mode == DuplicateReplace || mode == DuplicateKeep
+}
+
+// hashFile returns the hex SHA-256 of the file at path.
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// findDuplicate returns the latest version of a file that already holds the
+// job's content. Content that only survives in an older version is ingested
+// again, which brings it back as the latest. The registry records the hash
+// of every version, so no stored chunks need to be read.
+func (h *Handler) findDuplicate(job *Job) (Document, bool) {
+	doc, ok := h.documents.withHash(job.ContentHash)
+	// A job resumed after it was published finds its own document
+	if !ok || doc.ID == job.DocumentID {
+		return Document{}, false
+	}
+	return doc, true
+}
@@ -2,31 +2,79 @@ package document
 
 import (
 	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"os"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
+	"unicode"
 
+	"github.com/akhilmk/gowise/internal/auth"
+	"github.com/akhilmk/gowise/internal/resilient"
 	"github.com/google/uuid"
-	"github.com/ledongthuc/pdf"
 )
 
 type Config struct {
-	OllamaURL     string
-	ChromaURL     string
-	ChromaAPIBase string
-	DefaultModel  string
-	TargetModels  []string
-	Collection    string
+	OllamaURL      string
+	OpenAIURL      string
+	OpenAIAPIKey   string
+	VectorStore    string
+	ChromaURL      string
+	LocalStoreDir  string
+	QdrantURL      string
+	QdrantAPIKey   string
+	PgVectorDSN    string
+	DefaultModel   string
+	TargetModels   []string
+	ModelBackends  map[string]string // model name -> embedding backend
+	EmbedBatchSize int
+	IngestWorkers  int
+	JobWorkers     int
+	JobStoreDir    string
+	// DocumentStoreDir holds the registry of stored documents and their versions
+	DocumentStoreDir string
+	BlobStore        string // where original files are kept: local or s3
+	BlobStoreDir     string
+	S3Endpoint       string
+	S3Region         string
+	S3Bucket         string
+	S3AccessKey      string
+	S3SecretKey      string
+	// MaxFailedRatio is the share of chunks that may fail before an upload
+	// is marked failed and rolled back
+	MaxFailedRatio float64
+	PDF            PDFOptions // parallelism and timeouts for reading PDF pages
+	Collection     string
+	HTTP           resilient.Config // retries, timeouts and circuit breaking for Ollama, Chroma, ...
+	// ModelPullTimeout limits pulling one embedding model from Ollama at startup
+	ModelPullTimeout time.Duration
 }
 
 type Handler struct {
 	config Config
+	store  VectorStore
+	jobs   *JobManager
+	blobs  BlobStore
+
+	extractors *ExtractorRegistry
+
+	documentsMu sync.Mutex // serializes changes to which version of a file is latest
+	documents   *documentRegistry
+
+	ollamaClient *resilient.Client
+	openAIClient *resilient.Client
+
+	embeddersMu sync.Mutex
+	embedders   map[string]Embedder
 }
 
 func getEnv(key, defaultValue string) string {
@@ -36,6 +84,40 @@ func getEnv(key, defaultValue string) string {
 	return defaultValue
 }
 
+// getEnvInt parses a positive integer setting, falling back to defaultValue.
+func getEnvInt(key string, defaultValue int) int {
+	if value := os.Getenv(key); value != "" {
+		if parsed, err := strconv.Atoi(value); err == nil && parsed > 0 {
+			return parsed
+		}
+		log.Printf("[CONFIG WARNING] Invalid %s=%q, using default %d", key, value, defaultValue)
+	}
+	return defaultValue
+}
+
+// getEnvRatio parses a setting between 0 and 1, falling back to defaultValue.
+func getEnvRatio(key string, defaultValue float64) float64 {
+	if value := os.Getenv(key); value != "" {
+		if parsed, err := strconv.ParseFloat(value, 64); err == nil && parsed >= 0 && parsed <= 1 {
+			return parsed
+		}
+		log.Printf("[CONFIG WARNING] Invalid %s=%q, using default %g", key, value, defaultValue)
+	}
+	return defaultValue
+}
+
+// getEnvDuration parses a positive duration setting such as "500ms" or "30s",
+// falling back to defaultValue.
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	if value := os.Getenv(key); value != "" {
+		if parsed, err := time.ParseDuration(value); err == nil && parsed > 0 {
+			return parsed
+		}
+		log.Printf("[CONFIG WARNING] Invalid %s=%q, using default %s", key, value, defaultValue)
+	}
+	return defaultValue
+}
+
 func NewHandler() *Handler {
 	envModels := getEnv("EMBEDDING_MODELS", "")
 	var targetModels []string
@@ -56,15 +138,90 @@ func NewHandler() *Handler {
 
 	h := &Handler{
 		config: Config{
-			OllamaURL:     getEnv("OLLAMA_URL", "http://localhost:11434"),
-			ChromaURL:     getEnv("CHROMA_URL", "http://localhost:8000"),
-			ChromaAPIBase: "/api/v2/tenants/default_tenant/databases/default_database/collections",
-			DefaultModel:  targetModels[0], // Use first model as default
-			TargetModels:  targetModels,
-			Collection:    getEnv("COLLECTION_NAME", "documents"),
+			OllamaURL:        getEnv("OLLAMA_URL", "http://localhost:11434"),
+			OpenAIURL:        getEnv("OPENAI_URL", "http://localhost:8080"),
+			OpenAIAPIKey:     getEnv("OPENAI_API_KEY", ""),
+			VectorStore:      strings.ToLower(getEnv("VECTOR_STORE", StoreChroma)),
+			ChromaURL:        getEnv("CHROMA_URL", "http://localhost:8000"),
+			LocalStoreDir:    getEnv("LOCAL_STORE_DIR", "data"),
+			QdrantURL:        getEnv("QDRANT_URL", "http://localhost:6333"),
+			QdrantAPIKey:     getEnv("QDRANT_API_KEY", ""),
+			PgVectorDSN:      getEnv("PGVECTOR_DSN", "postgres://localhost:5432/gowise"),
+			DefaultModel:     targetModels[0], // Use first model as default
+			TargetModels:     targetModels,
+			ModelBackends:    parseModelBackends(getEnv("EMBEDDING_BACKENDS", "")),
+			EmbedBatchSize:   getEnvInt("EMBED_BATCH_SIZE", 16),
+			IngestWorkers:    getEnvInt("INGEST_CONCURRENCY", 4),
+			JobWorkers:       getEnvInt("JOB_WORKERS", 2),
+			JobStoreDir:      getEnv("JOB_STORE_DIR", "data/jobs"),
+			DocumentStoreDir: getEnv("DOCUMENT_STORE_DIR", "data/documents"),
+			BlobStore:        strings.ToLower(getEnv("BLOB_STORE", BlobStoreLocal)),
+			BlobStoreDir:     getEnv("BLOB_STORE_DIR", "data/files"),
+			S3Endpoint:       getEnv("S3_ENDPOINT", "http://localhost:9000"),
+			S3Region:         getEnv("S3_REGION", "us-east-1"),
+			S3Bucket:         getEnv("S3_BUCKET", "gowise"),
+			S3AccessKey:      getEnv("S3_ACCESS_KEY", ""),
+			S3SecretKey:      getEnv("S3_SECRET_KEY", ""),
+			MaxFailedRatio:   getEnvRatio("UPLOAD_FAILURE_THRESHOLD", 0.1),
+			Collection:       getEnv("COLLECTION_NAME", "documents"),
 		},
+		embedders: make(map[string]Embedder),
+	}
+
+	h.config.PDF = PDFOptions{
+		Workers:     getEnvInt("PDF_WORKERS", 4),
+		PageTimeout: getEnvDuration("PDF_PAGE_TIMEOUT", 10*time.Second),
+		Timeout:     getEnvDuration("PDF_TIMEOUT", 10*time.Minute),
+	}
+
+	httpDefaults := resilient.DefaultConfig()
+	h.config.HTTP = resilient.Config{
+		MaxAttempts:      getEnvInt("HTTP_MAX_ATTEMPTS", httpDefaults.MaxAttempts),
+		BaseDelay:        getEnvDuration("HTTP_RETRY_BASE_DELAY", httpDefaults.BaseDelay),
+		MaxDelay:         getEnvDuration("HTTP_RETRY_MAX_DELAY", httpDefaults.MaxDelay),
+		Timeout:          getEnvDuration("HTTP_TIMEOUT", httpDefaults.Timeout),
+		FailureThreshold: getEnvInt("CIRCUIT_FAILURE_THRESHOLD", httpDefaults.FailureThreshold),
+		Cooldown:         getEnvDuration("CIRCUIT_COOLDOWN", httpDefaults.Cooldown),
+	}
+	h.config.ModelPullTimeout = getEnvDuration("MODEL_PULL_TIMEOUT", 30*time.Minute)
+	h.extractors = newExtractorRegistry(h.config)
+	h.ollamaClient = resilient.New("ollama", h.config.HTTP)
+	h.openAIClient = resilient.New("openai", h.config.HTTP)
+
+	store, err := newVectorStore(h.config)
+	if err != nil {
+		log.Fatalf("[CRITICAL ERROR] Failed to initialize vector store: %v", err)
+	}
+	h.store = store
+
+	h.blobs, err = newBlobStore(h.config)
+	if err != nil {
+		log.Fatalf("[CRITICAL ERROR] Failed to initialize blob store: %v", err)
 	}
 
+	h.documents, err = newDocumentRegistry(h.config.DocumentStoreDir)
+	if err != nil {
+		log.Fatalf("[CRITICAL ERROR] Failed to load document registry: %v", err)
+	}
+	if err := h.migrateVersions(context.Background()); err != nil {
+		// Retried on the next start; until then older chunks are left out of search
+		log.Printf("[STARTUP WARNING] Failed to migrate stored chunks to versions: %v", err)
+	} else if err := h.migrateDocumentIDs(context.Background()); err != nil {
+		log.Printf("[STARTUP WARNING] Failed to assign document IDs: %v", err)
+	}
+
+	jobStore, err := newJobStore(h.config.JobStoreDir)
+	if err != nil {
+		log.Fatalf("[CRITICAL ERROR] Failed to initialize job store: %v", err)
+	}
+	h.jobs, err = NewJobManager(h.config.JobWorkers, jobStore, h.runJob)
+	if err != nil {
+		log.Fatalf("[CRITICAL ERROR] Failed to load ingestion jobs: %v", err)
+	}
+	log.Printf("[STARTUP] Using %s vector store for collection '%s' and %s blob store for original files",
+		h.config.VectorStore, h.config.Collection, h.config.BlobStore)
+	log.Printf("[STARTUP] Accepting uploads of type: %s", strings.Join(h.extractors.Types(), ", "))
+
 	// Initialize embedding model on startup (async)
 	go h.initializeEmbeddingModel()
 
@@ -74,17 +231,27 @@ func NewHandler() *Handler {
 func (h *Handler) RegisterRoutes(mux *http.ServeMux, mw func(http.HandlerFunc) http.HandlerFunc) {
 	mux.HandleFunc("/api/reset", mw(h.HandleReset))
 	mux.HandleFunc("/api/upload", mw(h.HandleUpload))
+	mux.HandleFunc("/api/jobs", mw(h.HandleJobs))
+	mux.HandleFunc("/api/jobs/", mw(h.HandleJob))
 	mux.HandleFunc("/api/search", mw(h.HandleSearch))
 	mux.HandleFunc("/api/stats", mw(h.HandleStats))
-	mux.HandleFunc("/api/files/", mw(h.HandleDeleteFile))
+	mux.HandleFunc("/api/files/", mw(h.HandleFile))
+	mux.HandleFunc("/api/documents", mw(h.HandleDocuments))
+	mux.HandleFunc("/api/documents/", mw(h.HandleDocument))
 	mux.HandleFunc("/api/models", mw(h.HandleModels))
 }
 
 func (h *Handler) initializeEmbeddingModel() {
 	log.Printf("[STARTUP] Initializing %d embedding models", len(h.config.TargetModels))
 
-	// Check if Ollama is reachable once
-	resp, err := http.Get(h.config.OllamaURL + "/api/tags")
+	// Check if Ollama is reachable, retrying while it starts up
+	ctx := context.Background()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, h.config.OllamaURL+"/api/tags", nil)
+	if err != nil {
+		log.Printf("[STARTUP WARNING] Invalid Ollama URL %q: %v", h.config.OllamaURL, err)
+		return
+	}
+	resp, err := h.ollamaClient.Do(req)
 	if err != nil {
 		log.Printf("[STARTUP WARNING] Failed to connect to Ollama: %v", err)
 		log.Printf("[STARTUP WARNING] Skipping model initialization - please ensure Ollama is running")
@@ -108,8 +275,20 @@ func (h *Handler) initializeEmbeddingModel() {
 		return
 	}
 
+	// Pulls stream their progress for minutes, so they get their own time
+	// limit and circuit instead of the per-call ones
+	pullHTTP := h.config.HTTP
+	pullHTTP.Timeout = h.config.ModelPullTimeout
+	pullClient := resilient.New("ollama-pull", pullHTTP)
+
 	// Iterate through each target model
 	for _, targetModel := range h.config.TargetModels {
+		// Only Ollama can pull models; other backends serve whatever they were started with
+		if h.config.backendFor(targetModel) != BackendOllama {
+			log.Printf("[STARTUP] Embedding model '%s' served by %s backend, skipping pull", targetModel, h.config.backendFor(targetModel))
+			continue
+		}
+
 		// Check if model already exists
 		modelExists := false
 		for _, model := range modelsResp.Models {
@@ -127,10 +306,15 @@ func (h *Handler) initializeEmbeddingModel() {
 		// Pull the model
 		log.Printf("[STARTUP] Pulling embedding model '%s' (this may take a few minutes)...", targetModel)
 
-		pullReq := map[string]string{"name": targetModel}
-		pullBody, _ := json.Marshal(pullReq)
+		pullBody, _ := json.Marshal(map[string]string{"name": targetModel})
 
-		pullResp, err := http.Post(h.config.OllamaURL+"/api/pull", "application/json", bytes.NewBuffer(pullBody))
+		pullReq, err := http.NewRequestWithContext(ctx, http.MethodPost, h.config.OllamaURL+"/api/pull", bytes.NewReader(pullBody))
+		if err != nil {
+			log.Printf("[STARTUP WARNING] Failed to pull model %s: %v", targetModel, err)
+			continue
+		}
+		pullReq.Header.Set("Content-Type", "application/json")
+		pullResp, err := pullClient.Do(pullReq)
 		if err != nil {
 			log.Printf("[STARTUP WARNING] Failed to pull model %s: %v", targetModel, err)
 			log.Printf("[STARTUP WARNING] You may need to manually run: ollama pull %s", targetModel)
@@ -175,56 +359,34 @@ func (h *Handler) initializeEmbeddingModel() {
 
 // Request/Response Structs
 type EmbeddingRequest struct {
-	Model  string `json:"model"`
-	Prompt string `json:"prompt"`
+	Model string   `json:"model"`
+	Input []string `json:"input"`
 }
 
 type EmbeddingResponse struct {
-	Embedding []float32 `json:"embedding"`
-}
-
-type ChromaAddRequest struct {
-	Documents  []string      `json:"documents"`
-	Metadatas  []interface{} `json:"metadatas"`
-	Ids        []string      `json:"ids"`
-	Embeddings [][]float32   `json:"embeddings"`
-}
-
-type ChromaQueryRequest struct {
-	QueryEmbeddings [][]float32 `json:"query_embeddings"`
-	NResults        int         `json:"n_results"`
-}
-
-type ChromaQueryResponse struct {
-	Ids       [][]string      `json:"ids"`
-	Documents [][]string      `json:"documents"`
-	Metadatas [][]interface{} `json:"metadatas"`
-	Distances [][]float32     `json:"distances"`
-}
-
-type ChromaGetResponse struct {
-	ID       string      `json:"id"`
-	Name     string      `json:"name"`
-	Metadata interface{} `json:"metadata"`
-}
-
-type ChromaCountResponse struct {
-	Count int `json:"count"`
-}
-
-type ChromaDeleteRequest struct {
-	Where map[string]interface{} `json:"where"`
+	Embeddings [][]float32 `json:"embeddings"`
 }
 
-type ChromaDeleteResponse struct {
-	DeletedCount int `json:"deleted_count"`
+// SearchResponse keeps the column-oriented shape of Chroma query results,
+// which the frontend consumes directly. Sources holds the registered
+// documents of the hits, keyed by the document_id in their metadata.
+type SearchResponse struct {
+	Ids       [][]string                 `json:"ids"`
+	Documents [][]string                 `json:"documents"`
+	Metadatas [][]map[string]interface{} `json:"metadatas"`
+	Distances [][]float32                `json:"distances"`
+	Sources   map[string]Document        `json:"sources"`
 }
 
+// StatsResponse summarises the collection. Documents lists the latest
+// version of every registered file, and FileChunkCounts counts the chunks
+// stored for each of them by document ID.
 type StatsResponse struct {
 	TotalChunks     int            `json:"total_chunks"`
 	TotalFiles      int            `json:"total_files"`
 	Files           []string       `json:"files"`
 	FileChunkCounts map[string]int `json:"file_chunk_counts"`
+	Documents       []Document     `json:"documents"`
 }
 
 type OllamaModel struct {
@@ -247,7 +409,12 @@ func (h *Handler) HandleModels(w http.ResponseWriter, r *http.Request) {
 
 	log.Printf("Fetching available Ollama models")
 
-	resp, err := http.Get(h.config.OllamaURL + "/api/tags")
+	req, err := http.NewRequestWithContext(r.Context(), http.MethodGet, h.config.OllamaURL+"/api/tags", nil)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to fetch models: %v", err), http.StatusInternalServerError)
+		return
+	}
+	resp, err := h.ollamaClient.Do(req)
 	if err != nil {
 		http.Error(w, fmt.Sprintf("failed to fetch models: %v", err), http.StatusInternalServerError)
 		return
@@ -266,6 +433,13 @@ func (h *Handler) HandleModels(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Models served by other backends are not known to Ollama, list them as configured
+	for _, model := range h.config.TargetModels {
+		if h.config.backendFor(model) != BackendOllama {
+			modelsResp.Models = append(modelsResp.Models, OllamaModel{Name: model})
+		}
+	}
+
 	log.Printf("Found %d Ollama models", len(modelsResp.Models))
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(modelsResp)
@@ -279,25 +453,29 @@ func (h *Handler) HandleReset(w http.ResponseWriter, r *http.Request) {
 
 	log.Printf("Resetting collection: %s", h.config.Collection)
 
-	url := fmt.Sprintf("%s%s/%s", h.config.ChromaURL, h.config.ChromaAPIBase, h.config.Collection)
-	req, err := http.NewRequest(http.MethodDelete, url, nil)
-	if err != nil {
-		http.Error(w, fmt.Sprintf("failed to create request: %v", err), http.StatusInternalServerError)
-		return
-	}
+	h.documentsMu.Lock()
+	defer h.documentsMu.Unlock()
 
-	resp, err := http.DefaultClient.Do(req)
+	// Unfinished jobs would publish into the emptied collection
+	cancelled, err := h.jobs.CancelMatching(func(*Job) bool { return true })
 	if err != nil {
-		http.Error(w, fmt.Sprintf("failed to delete collection: %v", err), http.StatusInternalServerError)
+		http.Error(w, "A job is publishing its version, try again when it has finished", http.StatusConflict)
 		return
 	}
-	defer resp.Body.Close()
+	if cancelled > 0 {
+		log.Printf("[JOB CANCEL REQUESTED] Cancelled %d unfinished jobs before the reset", cancelled)
+	}
 
-	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNotFound {
-		body, _ := io.ReadAll(resp.Body)
-		http.Error(w, fmt.Sprintf("chroma reset error: %s", string(body)), http.StatusInternalServerError)
+	if err := h.store.DropCollection(r.Context()); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	for _, doc := range h.documents.all(false) {
+		h.deleteOriginal(r.Context(), doc)
+	}
+	if err := h.documents.reset(); err != nil {
+		log.Printf("[DOCUMENT ERROR] Failed to reset document registry: %v", err)
+	}
 
 	log.Printf("Collection reset successful")
 	w.Header().Set("Content-Type", "application/json")
@@ -351,58 +529,105 @@ func (h *Handler) HandleUpload(w http.ResponseWriter, r *http.Request) {
 		embeddingModel = em
 	}
 
-	log.Printf("[UPLOAD CONFIG] File: %s | Chunk size: %d words | Stride: %d words | Overlap: %d words | Model: %s",
-		header.Filename, chunkSize, chunkStride, chunkSize-chunkStride, embeddingModel)
+	onDuplicate := DuplicateSkip
+	if od := r.FormValue("onDuplicate"); od != "" {
+		if !validDuplicateMode(od) {
+			http.Error(w, fmt.Sprintf("invalid onDuplicate %q (want %s, %s or %s)", od, DuplicateSkip, DuplicateReplace, DuplicateKeep), http.StatusBadRequest)
+			return
+		}
+		onDuplicate = od
+	}
+
+	// An upload starts a new file unless it is explicitly a new version of
+	// a stored one, named by one of its document IDs or by its file ID
+	fileID := uuid.NewString()
+	if ref := r.FormValue("versionOf"); ref != "" {
+		if doc, ok := h.documents.get(ref); ok {
+			fileID = doc.FileID
+		} else if h.documents.hasFile(ref) {
+			fileID = ref
+		} else {
+			http.Error(w, fmt.Sprintf("versionOf %q is not a stored document or file", ref), http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Reject formats nothing can extract before saving the file
+	contentType, err := sniffContentType(file, header.Size, header.Filename)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to read file: %v", err), http.StatusBadRequest)
+		return
+	}
+	if _, err := h.extractors.Lookup(contentType); err != nil {
+		log.Printf("[UPLOAD REJECTED] File: %s | Type: %s | Unsupported", header.Filename, contentType)
+		http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+		return
+	}
+
+	log.Printf("[UPLOAD CONFIG] File: %s | Type: %s | Chunk size: %d words | Stride: %d words | Overlap: %d words | Model: %s | On duplicate: %s",
+		header.Filename, contentType, chunkSize, chunkStride, chunkSize-chunkStride, embeddingModel, onDuplicate)
 
-	// Save file temporarily
-	tmpFile, err := os.CreateTemp("", "upload-*.pdf")
+	// Save file until its job finishes
+	tmpFile, err := h.jobs.createUploadFile()
 	if err != nil {
 		http.Error(w, fmt.Sprintf("failed to create temp file: %v", err), http.StatusInternalServerError)
 		return
 	}
-	defer os.Remove(tmpFile.Name())
-	defer tmpFile.Close()
-
-	_, err = io.Copy(tmpFile, file)
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmpFile, hash), file)
+	tmpFile.Close()
 	if err != nil {
+		os.Remove(tmpFile.Name())
 		log.Printf("[UPLOAD ERROR] File: %s | Failed to save: %v", header.Filename, err)
 		http.Error(w, fmt.Sprintf("failed to save file: %v", err), http.StatusInternalServerError)
 		return
 	}
 
-	log.Printf("[UPLOAD SAVED] File: %s | Temp path: %s", header.Filename, tmpFile.Name())
-
-	// Process PDF
-	// Process PDF with progress updates
-	w.Header().Set("Content-Type", "application/x-ndjson")
-	w.Header().Set("Transfer-Encoding", "chunked")
-	w.Header().Set("Cache-Control", "no-cache")
-	w.Header().Set("Connection", "keep-alive")
-
-	flusher, ok := w.(http.Flusher)
-	if !ok {
-		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+	log.Printf("[UPLOAD SAVED] File: %s | Path: %s", header.Filename, tmpFile.Name())
+
+	// Queue the file for processing; progress is available via /api/jobs/{id}/stream
+	job := &Job{
+		Filename:       header.Filename,
+		ChunkSize:      chunkSize,
+		ChunkStride:    chunkStride,
+		EmbeddingModel: embeddingModel,
+		ContentHash:    hex.EncodeToString(hash.Sum(nil)),
+		ContentType:    contentType,
+		OnDuplicate:    onDuplicate,
+		DocumentID:     uuid.NewString(),
+		FileID:         fileID,
+		Size:           size,
+		UploadedBy:     auth.Username(r.Context()),
+		path:           tmpFile.Name(),
+	}
+	if err := h.jobs.Enqueue(job); err != nil {
+		os.Remove(tmpFile.Name())
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
 		return
 	}
 
-	progressFunc := func(msg string) {
-		json.NewEncoder(w).Encode(map[string]string{"status": msg})
-		flusher.Flush()
-	}
+	log.Printf("[UPLOAD QUEUED] File: %s | Job: %s", header.Filename, job.ID)
 
-	err = h.processPDF(tmpFile.Name(), header.Filename, chunkSize, chunkStride, embeddingModel, progressFunc)
-	if err != nil {
-		log.Printf("Error processing PDF: %v", err)
-		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+	// wait=true keeps the request open with the NDJSON progress stream; the
+	// job is cancelled if the client goes away before it finishes
+	if r.FormValue("wait") == "true" {
+		h.streamJob(w, r, job.ID)
+		if r.Context().Err() != nil {
+			if _, err := h.jobs.Cancel(job.ID); err == nil {
+				log.Printf("[UPLOAD CANCELLED] File: %s | Job: %s | Client disconnected", header.Filename, job.ID)
+			}
+		}
 		return
 	}
 
-	log.Printf("[UPLOAD COMPLETE] File: %s | Processing finished successfully", header.Filename)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
 	json.NewEncoder(w).Encode(map[string]interface{}{
-		"status":      "completed",
+		"job_id":      job.ID,
+		"document_id": job.DocumentID,
+		"file_id":     job.FileID,
+		"status":      JobQueued,
 		"filename":    header.Filename,
-		"chunkSize":   chunkSize,
-		"chunkStride": chunkStride,
 	})
 }
 
@@ -418,22 +643,108 @@ func (h *Handler) HandleSearch(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Search the latest version of every file unless a document, a file, or
+	// one of its versions is asked for
+	where := Filter{"latest": true}
+	if id := r.URL.Query().Get("document_id"); id != "" {
+		// A document is one version of one file already
+		if r.URL.Query().Get("file_id") != "" || r.URL.Query().Get("version") != "" {
+			http.Error(w, "document_id cannot be combined with file_id or version", http.StatusBadRequest)
+			return
+		}
+		if _, ok := h.documents.get(id); !ok {
+			http.Error(w, errDocumentNotFound.Error(), http.StatusNotFound)
+			return
+		}
+		where = Filter{"document_id": id}
+	}
+	if filename := r.URL.Query().Get("filename"); filename != "" {
+		where["filename"] = filename
+	}
+	if author := r.URL.Query().Get("author"); author != "" {
+		where["author"] = author
+	}
+	if y := r.URL.Query().Get("year"); y != "" {
+		year, err := strconv.Atoi(y)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid year %q", y), http.StatusBadRequest)
+			return
+		}
+		where["created_year"] = year
+	}
+	// A file is searched in its latest version unless another one is asked
+	// for; a filename names a file only if no other file shares it
+	fileID := r.URL.Query().Get("file_id")
+	if fileID != "" && !h.documents.hasFile(fileID) {
+		http.Error(w, errFileNotFound.Error(), http.StatusNotFound)
+		return
+	}
+	if v := r.URL.Query().Get("version"); v != "" {
+		version, err := strconv.Atoi(v)
+		if err != nil || version <= 0 {
+			http.Error(w, fmt.Sprintf("invalid version %q", v), http.StatusBadRequest)
+			return
+		}
+		if fileID == "" {
+			filename, _ := where["filename"].(string)
+			if filename == "" {
+				http.Error(w, "version requires a file_id or filename", http.StatusBadRequest)
+				return
+			}
+			var ok bool
+			if fileID, ok = h.resolveFile(w, filename); !ok {
+				return
+			}
+			// Older versions may have been uploaded under another name
+			delete(where, "filename")
+		}
+		doc, ok := h.findVersion(fileID, version)
+		if !ok {
+			http.Error(w, errVersionNotFound.Error(), http.StatusNotFound)
+			return
+		}
+		delete(where, "latest")
+		where["document_id"] = doc.ID
+	} else if fileID != "" {
+		doc, _ := h.documents.latest(fileID)
+		where["document_id"] = doc.ID
+	}
+
 	log.Printf("Searching for: %s", query)
 
-	embedding, err := h.getEmbedding(query, h.config.DefaultModel)
+	embedding, err := h.getEmbedding(r.Context(), query, h.config.DefaultModel)
 	if err != nil {
 		http.Error(w, fmt.Sprintf("failed to get embedding: %v", err), http.StatusInternalServerError)
 		return
 	}
 
-	results, err := h.queryChroma(embedding)
+	results, err := h.store.Query(r.Context(), embedding, 5, where)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("failed to query chroma: %v", err), http.StatusInternalServerError)
+		http.Error(w, fmt.Sprintf("failed to query vector store: %v", err), http.StatusInternalServerError)
 		return
 	}
 
+	resp := SearchResponse{
+		Ids:       [][]string{make([]string, 0, len(results))},
+		Documents: [][]string{make([]string, 0, len(results))},
+		Metadatas: [][]map[string]interface{}{make([]map[string]interface{}, 0, len(results))},
+		Distances: [][]float32{make([]float32, 0, len(results))},
+		Sources:   make(map[string]Document),
+	}
+	for _, res := range results {
+		resp.Ids[0] = append(resp.Ids[0], res.ID)
+		resp.Documents[0] = append(resp.Documents[0], res.Text)
+		resp.Metadatas[0] = append(resp.Metadatas[0], res.Metadata)
+		resp.Distances[0] = append(resp.Distances[0], res.Distance)
+		if id, ok := res.Metadata["document_id"].(string); ok {
+			if doc, ok := h.documents.get(id); ok {
+				resp.Sources[id] = doc
+			}
+		}
+	}
+
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(results)
+	json.NewEncoder(w).Encode(resp)
 }
 
 func (h *Handler) HandleStats(w http.ResponseWriter, r *http.Request) {
@@ -444,10 +755,9 @@ func (h *Handler) HandleStats(w http.ResponseWriter, r *http.Request) {
 
 	log.Printf("Fetching collection statistics")
 
-	// Get or create collection to ensure it exists
-	colID, err := h.getOrCreateCollection(h.config.Collection)
+	count, err := h.store.Count(r.Context())
 	if err != nil {
-		log.Printf("Failed to get collection: %v", err)
+		log.Printf("Failed to get collection count: %v", err)
 		// Return empty stats if collection doesn't exist
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(StatsResponse{
@@ -455,413 +765,314 @@ func (h *Handler) HandleStats(w http.ResponseWriter, r *http.Request) {
 			TotalFiles:      0,
 			Files:           []string{},
 			FileChunkCounts: make(map[string]int),
+			Documents:       []Document{},
 		})
 		return
 	}
 
-	// Get collection count
-	countURL := fmt.Sprintf("%s%s/%s/count", h.config.ChromaURL, h.config.ChromaAPIBase, colID)
-	resp, err := http.Get(countURL)
-	if err != nil {
-		http.Error(w, fmt.Sprintf("failed to get count: %v", err), http.StatusInternalServerError)
-		return
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		http.Error(w, fmt.Sprintf("chroma count error: %s", string(body)), http.StatusInternalServerError)
-		return
+	// Count the chunks of the latest version of every file, like search sees them
+	fileChunkCounts := make(map[string]int)
+	if counter, ok := h.store.(FileCounter); ok && count > 0 {
+		// Let the store aggregate instead of pulling every metadata record
+		counts, err := counter.FileChunkCounts(r.Context())
+		if err != nil {
+			log.Printf("Failed to count chunks per file: %v", err)
+		}
+		fileChunkCounts = counts
+	} else if count > 0 {
+		metadatas, err := h.store.ListMetadata(r.Context(), Filter{"latest": true})
+		if err != nil {
+			log.Printf("Failed to list metadata: %v", err)
+		}
+		for _, meta := range metadatas {
+			if id, ok := meta["document_id"].(string); ok {
+				fileChunkCounts[id]++
+			}
+		}
 	}
-
-	var count int
-	if err := json.NewDecoder(resp.Body).Decode(&count); err != nil {
-		http.Error(w, fmt.Sprintf("failed to decode count: %v", err), http.StatusInternalServerError)
-		return
+	if fileChunkCounts == nil {
+		fileChunkCounts = make(map[string]int)
 	}
 
-	// Get all documents to extract unique filenames and count chunks per file
 	files := []string{}
-	fileChunkCounts := make(map[string]int)
-
-	if count > 0 {
-
-		getURL := fmt.Sprintf("%s%s/%s/get", h.config.ChromaURL, h.config.ChromaAPIBase, colID)
-
-		// Request all metadata to find unique files and count chunks
-		reqBody, _ := json.Marshal(map[string]interface{}{
-			"limit":   count,
-			"include": []string{"metadatas"},
-		})
-
-		getResp, err := http.Post(getURL, "application/json", bytes.NewBuffer(reqBody))
-		if err == nil {
-			defer getResp.Body.Close()
-			if getResp.StatusCode == http.StatusOK {
-				var data struct {
-					Metadatas []map[string]interface{} `json:"metadatas"`
-				}
-				if err := json.NewDecoder(getResp.Body).Decode(&data); err == nil {
-					fileSet := make(map[string]bool)
-					for _, meta := range data.Metadatas {
-						if filename, ok := meta["filename"].(string); ok {
-							fileSet[filename] = true
-							fileChunkCounts[filename]++
-						}
-					}
-					for filename := range fileSet {
-						files = append(files, filename)
-					}
-				}
-			}
+	for id := range fileChunkCounts {
+		if doc, ok := h.documents.get(id); ok {
+			files = append(files, doc.Filename)
 		}
 	}
+	sort.Strings(files)
+
+	documents := h.documents.all(true)
+	if documents == nil {
+		documents = []Document{}
+	}
 
-	log.Printf("Collection stats: %d chunks, %d files", count, len(files))
+	log.Printf("Collection stats: %d chunks, %d files", count, len(fileChunkCounts))
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(StatsResponse{
 		TotalChunks:     count,
-		TotalFiles:      len(files),
+		TotalFiles:      len(fileChunkCounts),
 		Files:           files,
 		FileChunkCounts: fileChunkCounts,
+		Documents:       documents,
 	})
 }
 
-func (h *Handler) HandleDeleteFile(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodDelete {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
-	// Extract filename from URL path
-	filename := strings.TrimPrefix(r.URL.Path, "/api/files/")
-	if filename == "" {
-		http.Error(w, "Filename required", http.StatusBadRequest)
-		return
-	}
-
-	log.Printf("Deleting file: %s", filename)
+// Helpers
 
-	// Get collection ID
-	colID, err := h.getOrCreateCollection(h.config.Collection)
-	if err != nil {
-		http.Error(w, fmt.Sprintf("failed to get collection: %v", err), http.StatusInternalServerError)
-		return
+// processFile ingests the upload of a job as a new version of its file: it
+// extracts the text with the extractor for the job's content type, splits it
+// into chunks, embeds and stores them, keeps the original and publishes the
+// version, which in replace mode purges the file's older versions. The result
+// reports what happened to the pages and chunks. In skip mode an upload
+// identical to a stored document is not ingested at all, and a resumed job
+// starts after its checkpoint. It fails when more than MaxFailedRatio of the
+// chunks could not be stored, and returns ctx.Err() when ctx is cancelled
+// before publishing starts.
+func (h *Handler) processFile(ctx context.Context, job *Job, progress func(string)) (IngestResult, error) {
+	path, filename := job.path, job.Filename
+	chunkSize, chunkStride, embeddingModel := job.ChunkSize, job.ChunkStride, job.EmbeddingModel
+	log.Printf("[FILE PROCESSING START] File: %s | Path: %s | Type: %s", filename, path, job.ContentType)
+
+	var result IngestResult
+	if job.Result != nil && job.Checkpoint > 0 {
+		// Keep the chunk counts of the run that was interrupted
+		result = *job.Result
+	}
+
+	if job.OnDuplicate == DuplicateSkip {
+		if existing, ok := h.findDuplicate(job); ok {
+			log.Printf("[FILE PROCESSING SKIPPED] File: %s | Identical to stored document %s (%s) | Hash: %s", filename, existing.ID, existing.Filename, job.ContentHash)
+			if progress != nil {
+				progress(fmt.Sprintf("Identical document already stored as %s - skipping", existing.Filename))
+			}
+			result.DuplicateOf = existing.Filename
+			result.DuplicateID = existing.ID
+			return result, nil
+		}
 	}
 
-	// Delete all chunks with matching filename
-	reqBody, _ := json.Marshal(ChromaDeleteRequest{
-		Where: map[string]interface{}{
-			"filename": filename,
-		},
-	})
-
-	url := fmt.Sprintf("%s%s/%s/delete", h.config.ChromaURL, h.config.ChromaAPIBase, colID)
-	resp, err := http.Post(url, "application/json", bytes.NewBuffer(reqBody))
+	extractor, err := h.extractors.Lookup(job.ContentType)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("failed to delete: %v", err), http.StatusInternalServerError)
-		return
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode >= 300 {
-		body, _ := io.ReadAll(resp.Body)
-		http.Error(w, fmt.Sprintf("chroma delete error: %s", string(body)), http.StatusInternalServerError)
-		return
+		return result, err
 	}
 
-	log.Printf("Successfully deleted file: %s", filename)
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"status":   "deleted",
-		"filename": filename,
-	})
-}
-
-// Helpers
-
-func (h *Handler) processPDF(path, filename string, chunkSize, chunkStride int, embeddingModel string, progress func(string)) error {
-	log.Printf("[PDF PROCESSING START] File: %s | Path: %s", filename, path)
-
-	if progress != nil {
-		progress("Reading PDF file...")
+	if err := h.reserveVersion(job); err != nil {
+		return result, err
 	}
 
-	content, err := ReadPDF(path, filename, progress)
+	extracted, err := extractor.Extract(ctx, path, filename, progress)
 	if err != nil {
-		log.Printf("[PDF ERROR] File: %s | Failed to read: %v", filename, err)
-		return fmt.Errorf("failed to read PDF: %v", err)
+		log.Printf("[FILE ERROR] File: %s | Failed to extract %s: %v", filename, extractor.Name(), err)
+		return result, err
 	}
+	content := extracted.Text
+	result.PagesTotal = extracted.Pages
+	result.PagesSkipped = extracted.Skipped
 
 	// Report extracted content size
 	contentLen := len(content)
 	trimmedLen := len(strings.TrimSpace(content))
-	log.Printf("[PDF EXTRACTION] File: %s | Extracted: %d chars | Trimmed: %d chars",
+	log.Printf("[FILE EXTRACTION] File: %s | Extracted: %d chars | Trimmed: %d chars",
 		filename, contentLen, trimmedLen)
 
 	if progress != nil {
-		progress(fmt.Sprintf("Extracted %d characters from PDF", contentLen))
+		progress(fmt.Sprintf("Extracted %d characters from %s", contentLen, extractor.Name()))
 	}
 
 	if trimmedLen == 0 {
-		log.Printf("[PDF ERROR] File: %s | No text content extracted (possibly scanned/image-based PDF)", filename)
-		return fmt.Errorf("no text content extracted from PDF (file might be scanned or image-based)")
+		log.Printf("[FILE ERROR] File: %s | No text content extracted (possibly scanned/image-based)", filename)
+		return result, fmt.Errorf("no text content extracted from %s (file might be scanned or image-based)", extractor.Name())
 	}
 
 	if progress != nil {
 		progress("Splitting text into chunks...")
 	}
 
-	chunks := ChunkText(content, chunkSize, chunkStride)
-	log.Printf("[PDF CHUNKING] File: %s | Total chunks: %d | Chunk size: %d words | Stride: %d words",
+	chunks := ChunkContent(extracted, chunkSize, chunkStride)
+	result.ChunksCreated = len(chunks)
+	log.Printf("[FILE CHUNKING] File: %s | Total chunks: %d | Chunk size: %d words | Stride: %d words",
 		filename, len(chunks), chunkSize, chunkStride)
 
 	if len(chunks) == 0 {
-		log.Printf("[PDF ERROR] File: %s | Resulted in 0 chunks (text too short)", filename)
-		return fmt.Errorf("resulted in 0 chunks (text might be too short)")
+		log.Printf("[FILE ERROR] File: %s | Resulted in 0 chunks (text too short)", filename)
+		return result, fmt.Errorf("resulted in 0 chunks (text might be too short)")
 	}
 
 	if progress != nil {
 		progress(fmt.Sprintf("Created %d chunks - Starting embedding...", len(chunks)))
 	}
 
-	for i, chunk := range chunks {
-		msg := fmt.Sprintf("Processing chunk %d/%d", i+1, len(chunks))
-		if progress != nil {
-			progress(msg)
-		}
-		log.Printf("[CHUNK PROCESSING] File: %s | Chunk: %d/%d | Length: %d chars",
-			filename, i+1, len(chunks), len(chunk))
-
-		embedding, err := h.getEmbedding(chunk, embeddingModel)
-		if err != nil {
-			log.Printf("[CHUNK WARNING] File: %s | Chunk: %d/%d | Embedding failed: %v",
-				filename, i+1, len(chunks), err)
-			continue
-		}
+	embedder, err := h.embedder(embeddingModel)
+	if err != nil {
+		return result, err
+	}
 
-		err = h.addToChroma(chunk, embedding, filename, i+1)
-		if err != nil {
-			log.Printf("[CHUNK WARNING] File: %s | Chunk: %d/%d | Storage failed: %v",
-				filename, i+1, len(chunks), err)
-			continue
+	from := min(job.Checkpoint, len(chunks))
+	if from > 0 {
+		log.Printf("[FILE PROCESSING RESUME] File: %s | Resuming after chunk %d/%d", filename, from, len(chunks))
+		if progress != nil {
+			progress(fmt.Sprintf("Resuming after chunk %d/%d", from, len(chunks)))
 		}
-
-		log.Printf("[CHUNK SUCCESS] File: %s | Stored chunk: %d/%d", filename, i+1, len(chunks))
 	}
 
-	log.Printf("[PDF PROCESSING COMPLETE] File: %s | Total chunks: %d", filename, len(chunks))
-	return nil
-}
+	// Fields shared by every chunk of the file
+	meta := extracted.Info.metadata()
+	meta["source"] = extractor.Name()
+	meta["content_type"] = job.ContentType
 
-func (h *Handler) getEmbedding(text string, model string) ([]float32, error) {
-	reqBody, _ := json.Marshal(EmbeddingRequest{
-		Model:  model,
-		Prompt: text,
-	})
-
-	resp, err := http.Post(h.config.OllamaURL+"/api/embeddings", "application/json", bytes.NewBuffer(reqBody))
-	if err != nil {
-		return nil, fmt.Errorf("http post error: %w", err)
+	h.ingestChunks(ctx, embedder, job, meta, chunks, from, &result, progress)
+	if err := ctx.Err(); err != nil {
+		log.Printf("[FILE PROCESSING CANCELLED] File: %s | Stored before cancel: %d", filename, result.ChunksStored)
+		return result, err
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("ollama returned status %d: %s", resp.StatusCode, string(body))
+	log.Printf("[FILE PROCESSING COMPLETE] File: %s | Total chunks: %d | Embedded: %d | Stored: %d | Failed: %d | Pages skipped: %d",
+		filename, len(chunks), result.ChunksEmbedded, result.ChunksStored, result.ChunksFailed, len(result.PagesSkipped))
+	if progress != nil {
+		progress(fmt.Sprintf("Stored %d of %d chunks, %d failed", result.ChunksStored, len(chunks), result.ChunksFailed))
 	}
 
-	var res EmbeddingResponse
-	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
-		return nil, fmt.Errorf("failed to decode response: %w", err)
+	if result.ChunksStored == 0 || float64(result.ChunksFailed) > h.config.MaxFailedRatio*float64(len(chunks)) {
+		return result, fmt.Errorf("%d of %d chunks failed, more than the allowed %g%%",
+			result.ChunksFailed, len(chunks), h.config.MaxFailedRatio*100)
 	}
 
-	return res.Embedding, nil
-}
-
-func (h *Handler) addToChroma(text string, embedding []float32, filename string, chunkNum int) error {
-	colID, err := h.getOrCreateCollection(h.config.Collection)
-	if err != nil {
-		return fmt.Errorf("getOrCreateCollection failed: %w", err)
-	}
-
-	id := uuid.New().String()
-	reqBody, _ := json.Marshal(ChromaAddRequest{
-		Documents: []string{text},
-		Metadatas: []interface{}{map[string]interface{}{
-			"source":      "pdf",
-			"filename":    filename,
-			"chunk_num":   chunkNum,
-			"uploaded_at": time.Now().Format(time.RFC3339),
-		}},
-		Ids:        []string{id},
-		Embeddings: [][]float32{embedding},
-	})
-
-	url := fmt.Sprintf("%s%s/%s/add", h.config.ChromaURL, h.config.ChromaAPIBase, colID)
-	resp, err := http.Post(url, "application/json", bytes.NewBuffer(reqBody))
-	if err != nil {
-		return fmt.Errorf("http post to %s failed: %w", url, err)
+	// Keep the original so it can be downloaded; the upload itself is
+	// removed once the job ends
+	if err := h.blobs.Put(ctx, job.DocumentID, path); err != nil {
+		log.Printf("[FILE ERROR] File: %s | Failed to store original: %v", filename, err)
+		return result, fmt.Errorf("failed to store original file: %w", err)
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode >= 300 {
-		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("chroma add returned status %d: %s", resp.StatusCode, string(body))
+	// Publishing flips which version is latest and may purge older ones, so
+	// it must not be interrupted half way
+	if !h.jobs.startPublishing(job) {
+		return result, ctx.Err()
 	}
-
-	return nil
+	if err := h.publishVersion(context.WithoutCancel(ctx), job, extracted.Info, result); err != nil {
+		return result, err
+	}
+	return result, nil
 }
 
-func (h *Handler) queryChroma(embedding []float32) (*ChromaQueryResponse, error) {
-	colID, err := h.getOrCreateCollection(h.config.Collection)
+func (h *Handler) getEmbedding(ctx context.Context, text string, model string) ([]float32, error) {
+	e, err := h.embedder(model)
 	if err != nil {
 		return nil, err
 	}
 
-	reqBody, _ := json.Marshal(ChromaQueryRequest{
-		QueryEmbeddings: [][]float32{embedding},
-		NResults:        5,
-	})
-
-	url := fmt.Sprintf("%s%s/%s/query", h.config.ChromaURL, h.config.ChromaAPIBase, colID)
-	resp, err := http.Post(url, "application/json", bytes.NewBuffer(reqBody))
+	embeddings, err := e.Embed(ctx, []string{text})
 	if err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode >= 300 {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("chroma query returned status %d: %s", resp.StatusCode, string(body))
-	}
 
-	var res ChromaQueryResponse
-	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
-		return nil, err
-	}
+	return embeddings[0], nil
+}
 
-	return &res, nil
+// TextChunk is a chunk of text and the pages it was taken from. PageStart and
+// PageEnd are 0 when the text has no page information. Section and Chapter
+// are the titles of the section and chapter the chunk starts in, if any.
+type TextChunk struct {
+	Text      string
+	PageStart int
+	PageEnd   int
+	Section   string
+	Chapter   string
 }
 
-func (h *Handler) getOrCreateCollection(name string) (string, error) {
-	// 1. Try to get
-	getURL := fmt.Sprintf("%s%s/%s", h.config.ChromaURL, h.config.ChromaAPIBase, name)
-	resp, err := http.Get(getURL)
-	if err == nil {
-		defer resp.Body.Close()
-		if resp.StatusCode == http.StatusOK {
-			var res struct {
-				ID string `json:"id"`
-			}
-			if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
-				return "", fmt.Errorf("failed to decode get collection response: %w", err)
+// ChunkContent splits extracted content into chunks of `size` words, starting
+// a new chunk every `stride` words, and records the pages each chunk spans and the
+// section and chapter it starts in. A word belongs to the page it starts on.
+// Whitespace inside verbatim spans such as code blocks is kept as is, and a
+// chunk that would end inside one runs on to its end if that adds at most
+// `size` words.
+// Line breaks elsewhere are kept only if c.KeepLineBreaks is set.
+func ChunkContent(c *Content, size int, stride int) []TextChunk {
+	text := c.Text
+
+	// Find each word the way strings.Fields splits
+	type word struct {
+		start, end int
+		span       int // index into c.Verbatim, or -1
+	}
+	var words []word
+	start := -1
+	for i, r := range text {
+		if unicode.IsSpace(r) {
+			if start >= 0 {
+				words = append(words, word{start: start, end: i, span: -1})
+				start = -1
 			}
-			return res.ID, nil
+		} else if start < 0 {
+			start = i
 		}
 	}
-
-	// 2. Create if not found or status not OK
-	createURL := fmt.Sprintf("%s%s", h.config.ChromaURL, h.config.ChromaAPIBase)
-	reqBody, _ := json.Marshal(map[string]string{"name": name})
-	resp, err = http.Post(createURL, "application/json", bytes.NewBuffer(reqBody))
-	if err != nil {
-		return "", fmt.Errorf("failed to POST to %s: %w", createURL, err)
-	}
-	defer resp.Body.Close()
-
-	body, _ := io.ReadAll(resp.Body)
-	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
-		return "", fmt.Errorf("create collection at %s returned status %d: %s", createURL, resp.StatusCode, string(body))
+	if start >= 0 {
+		words = append(words, word{start: start, end: len(text), span: -1})
 	}
-
-	var res struct {
-		ID string `json:"id"`
-	}
-	if err := json.Unmarshal(body, &res); err != nil {
-		return "", fmt.Errorf("failed to decode create collection response: %w", err)
-	}
-
-	if res.ID == "" {
-		return "", fmt.Errorf("received empty collection ID from ChromaDB")
-	}
-
-	return res.ID, nil
-}
-
-// ReadPDF extracts plain text from a PDF file at the given path.
-func ReadPDF(path, filename string, progress func(string)) (string, error) {
-	f, r, err := pdf.Open(path)
-	if err != nil {
-		log.Printf("[PDF OPEN ERROR] File: %s | Error: %v", filename, err)
-		return "", err
+	if len(words) == 0 {
+		return nil
 	}
-	defer f.Close()
-
-	total := r.NumPage()
-	log.Printf("[PDF READING] File: %s | Total pages: %d", filename, total)
-
-	var buf bytes.Buffer
 
-	for i := 1; i <= total; i++ {
-		// Report progress more frequently for large PDFs
-		if progress != nil {
-			if total < 20 || i%5 == 0 || i == 1 || i == total {
-				progress(fmt.Sprintf("Reading PDF page %d/%d", i, total))
-			}
+	span := 0
+	for i := range words {
+		for span < len(c.Verbatim) && c.Verbatim[span].End <= words[i].start {
+			span++
 		}
-
-		p := r.Page(i)
-		if p.V.IsNull() {
-			log.Printf("[PDF PAGE SKIP] File: %s | Page: %d/%d | Reason: null page", filename, i, total)
-			continue
+		if span < len(c.Verbatim) && c.Verbatim[span].Start <= words[i].start {
+			words[i].span = span
 		}
+	}
 
-		type pageResult struct {
-			text string
-			err  error
-		}
-		ch := make(chan pageResult, 1)
-		go func() {
-			text, err := p.GetPlainText(nil)
-			ch <- pageResult{text, err}
-		}()
-
-		select {
-		case res := <-ch:
-			if res.err != nil {
-				log.Printf("[PDF PAGE ERROR] File: %s | Page: %d/%d | Error: %v", filename, i, total, res.err)
-				continue
-			}
-			buf.WriteString(res.text)
-		case <-time.After(10 * time.Second):
-			log.Printf("[PDF PAGE TIMEOUT] File: %s | Page: %d/%d | Skipping after 10s", filename, i, total)
-			if progress != nil {
-				progress(fmt.Sprintf("Skipped page %d (timeout)", i))
+	join := func(from, to int) string {
+		var b strings.Builder
+		for k := from; k < to; k++ {
+			if k > from {
+				gap := text[words[k-1].end:words[k].start]
+				switch {
+				case words[k].span >= 0 && words[k].span == words[k-1].span:
+					b.WriteString(gap)
+				case c.KeepLineBreaks && strings.Count(gap, "\n") > 1:
+					b.WriteString("\n\n")
+				case c.KeepLineBreaks && strings.Contains(gap, "\n"):
+					b.WriteByte('\n')
+				default:
+					b.WriteByte(' ')
+				}
 			}
-			continue
+			b.WriteString(text[words[k].start:words[k].end])
 		}
+		return b.String()
 	}
 
-	log.Printf("[PDF READING COMPLETE] File: %s | Pages processed: %d | Text length: %d chars",
-		filename, total, buf.Len())
-	return buf.String(), nil
-}
-
-// ChunkText splits the text into chunks of `size` words with a `stride`.
-func ChunkText(text string, size int, stride int) []string {
-	var chunks []string
-	words := strings.Fields(text)
-	if len(words) == 0 {
-		return nil
+	pageAt := func(offset int) int {
+		i := sort.Search(len(c.Offsets), func(i int) bool { return c.Offsets[i].Offset > offset })
+		if i == 0 {
+			return 0
+		}
+		return c.Offsets[i-1].Page
 	}
 
+	var chunks []TextChunk
 	for i := 0; i < len(words); i += stride {
-		end := i + size
-		if end > len(words) {
-			end = len(words)
+		end := min(i+size, len(words))
+		if last := words[end-1].span; last >= 0 && end < len(words) && words[end].span == last {
+			spanEnd := end
+			for spanEnd < len(words) && words[spanEnd].span == last {
+				spanEnd++
+			}
+			if spanEnd-end <= size {
+				end = spanEnd
+			}
 		}
-		chunks = append(chunks, strings.Join(words[i:end], " "))
+		chunks = append(chunks, TextChunk{
+			Text:      join(i, end),
+			PageStart: pageAt(words[i].start),
+			PageEnd:   pageAt(words[end-1].start),
+			Section:   sectionAt(c.Sections, words[i].start),
+			Chapter:   sectionAt(c.Chapters, words[i].start),
+		})
 		if end == len(words) {
 			break
 		}
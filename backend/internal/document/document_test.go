@@ -0,0 +1,140 @@
+package document
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// pagedContent is the content of a file with the given page texts, laid out
+// the way the PDF extractor does.
+func pagedContent(pages ...string) *Content {
+	c := &Content{Pages: len(pages)}
+	for i, p := range pages {
+		c.Offsets = append(c.Offsets, PageOffset{Page: i + 1, Offset: len(c.Text)})
+		c.Text += p + "\n"
+	}
+	return c
+}
+
+func TestChunkContentPages(t *testing.T) {
+	tests := []struct {
+		name         string
+		content      *Content
+		size, stride int
+		want         []TextChunk
+	}{
+		{
+			name:    "chunk spanning two pages",
+			content: pagedContent("one two three", "four five six"),
+			size:    4, stride: 4,
+			want: []TextChunk{
+				{Text: "one two three four", PageStart: 1, PageEnd: 2},
+				{Text: "five six", PageStart: 2, PageEnd: 2},
+			},
+		},
+		{
+			name:    "chunk starting on a page boundary",
+			content: pagedContent("one two three", "four five six"),
+			size:    3, stride: 3,
+			want: []TextChunk{
+				{Text: "one two three", PageStart: 1, PageEnd: 1},
+				{Text: "four five six", PageStart: 2, PageEnd: 2},
+			},
+		},
+		{
+			name:    "stride smaller than size",
+			content: pagedContent("one two", "three four", "five six"),
+			size:    3, stride: 2,
+			want: []TextChunk{
+				{Text: "one two three", PageStart: 1, PageEnd: 2},
+				{Text: "three four five", PageStart: 2, PageEnd: 3},
+				{Text: "five six", PageStart: 3, PageEnd: 3},
+			},
+		},
+		{
+			name:    "empty pages are skipped over",
+			content: pagedContent("one two", "", "three"),
+			size:    3, stride: 3,
+			want: []TextChunk{
+				{Text: "one two three", PageStart: 1, PageEnd: 3},
+			},
+		},
+		{
+			name:    "no pages",
+			content: &Content{Text: "one two three"},
+			size:    2, stride: 2,
+			want: []TextChunk{
+				{Text: "one two"},
+				{Text: "three"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ChunkContent(tt.content, tt.size, tt.stride)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("chunks = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestChunkContentSections(t *testing.T) {
+	text := "Intro text. Install here. Usage here."
+	c := &Content{
+		Text: text,
+		Sections: []Section{
+			{Title: "Install", Offset: strings.Index(text, "Install")},
+			{Title: "Usage", Offset: strings.Index(text, "Usage")},
+		},
+	}
+	var got []string
+	for _, chunk := range ChunkContent(c, 2, 2) {
+		got = append(got, chunk.Section)
+	}
+	// A chunk belongs to the section it starts in
+	if want := []string{"", "Install", "Usage"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("sections = %q, want %q", got, want)
+	}
+}
+
+func TestChunkContentVerbatim(t *testing.T) {
+	code := "One two.\n\n```\nx  = 1\n```\n\nEnd.\n"
+	tests := []struct {
+		name         string
+		text         string
+		size, stride int
+		want         []string
+	}{
+		{
+			name: "fence longer than the chunk size is split",
+			text: "Intro.\n\n```\na  b\nc d e f\n```\n\nAfter.\n",
+			size: 3, stride: 3,
+			want: []string{"Intro. ```\na", "b\nc d e f\n```", "e f\n```", "After."},
+		},
+		{
+			name: "chunk ending inside a fence runs on to its end",
+			text: code,
+			size: 4, stride: 4,
+			want: []string{"One two. ```\nx  = 1\n```", "= 1\n``` End."},
+		},
+		{
+			name: "fence straddling a chunk boundary is split if the rest is too long",
+			text: code,
+			size: 3, stride: 3,
+			want: []string{"One two. ```", "x  = 1\n```", "``` End."},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, chunk := range ChunkContent(parseMarkdown(tt.text), tt.size, tt.stride) {
+				got = append(got, chunk.Text)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("chunks = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
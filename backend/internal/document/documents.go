@@ -0,0 +1,631 @@
+package document
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	errDocumentNotFound = errors.New("document not found")
+	errVersionNotFound  = errors.New("version not found")
+	errFileNotFound     = errors.New("file not found")
+)
+
+// Document is one stored upload: a version of a file. Every upload starts a
+// new file with its own ID unless it is explicitly uploaded as a new version
+// of an existing one, so two unrelated uploads that share a filename never
+// become versions of each other. Its chunks carry the ID in the
+// "document_id" metadata field and the version number in "version"; the
+// chunks of the latest version of each file also carry latest=true, which is
+// what search matches by default.
+type Document struct {
+	ID             string    `json:"id"`
+	FileID         string    `json:"file_id"` // shared by every version of the file
+	Filename       string    `json:"filename"`
+	Version        int       `json:"version"`
+	Latest         bool      `json:"latest"`
+	ContentHash    string    `json:"content_hash,omitempty"`
+	ContentType    string    `json:"content_type,omitempty"` // MIME type of the original file
+	Size           int64     `json:"size,omitempty"`         // bytes
+	Pages          int       `json:"pages,omitempty"`        // pages in the file, including skipped ones
+	Chunks         int       `json:"chunks"`
+	ChunkSize      int       `json:"chunk_size,omitempty"`
+	ChunkStride    int       `json:"chunk_stride,omitempty"`
+	EmbeddingModel string    `json:"embedding_model,omitempty"`
+	UploadedBy     string    `json:"uploaded_by,omitempty"`
+	JobID          string    `json:"job_id,omitempty"`
+	File           string    `json:"file,omitempty"` // blob store key of the original file
+	DocumentInfo             // title, author, subject and creation date from the file
+	UploadedAt     time.Time `json:"uploaded_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// fileVersions is the version history of one file. Next is the last version
+// number handed out, so numbers of failed uploads are not reused.
+type fileVersions struct {
+	Next     int        `json:"next"`
+	Latest   int        `json:"latest"`
+	Versions []Document `json:"versions"`
+}
+
+type registryData struct {
+	// Migrated is set once chunks stored before versioning have been
+	// tagged as version 1 of their file
+	Migrated bool `json:"migrated"`
+	// FileIDs is set once Files is keyed by file ID; before that every
+	// upload of a filename was a version of it and Files was keyed by
+	// filename
+	FileIDs bool                     `json:"file_ids"`
+	Files   map[string]*fileVersions `json:"files"`
+}
+
+// documentRegistry persists every stored document, grouped into the version
+// history of its file, as a single JSON file.
+type documentRegistry struct {
+	mu   sync.Mutex
+	path string
+	data registryData
+	byID map[string]string // document ID -> file ID
+}
+
+func newDocumentRegistry(dir string) (*documentRegistry, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create document store directory %s: %w", dir, err)
+	}
+	r := &documentRegistry{
+		path: filepath.Join(dir, "documents.json"),
+		data: registryData{FileIDs: true, Files: make(map[string]*fileVersions)},
+		byID: make(map[string]string),
+	}
+
+	data, err := os.ReadFile(r.path)
+	if os.IsNotExist(err) {
+		// Written under this name before documents had IDs
+		data, err = os.ReadFile(filepath.Join(dir, "versions.json"))
+	}
+	if os.IsNotExist(err) {
+		return r, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", r.path, err)
+	}
+	r.data.FileIDs = false
+	if err := json.Unmarshal(data, &r.data); err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %w", r.path, err)
+	}
+	if r.data.Files == nil {
+		r.data.Files = make(map[string]*fileVersions)
+	}
+
+	if !r.data.FileIDs {
+		// The versions of each filename become one file
+		files := make(map[string]*fileVersions, len(r.data.Files))
+		for filename, f := range r.data.Files {
+			if len(f.Versions) == 0 {
+				continue
+			}
+			fileID := uuid.NewString()
+			for i := range f.Versions {
+				f.Versions[i].FileID = fileID
+				f.Versions[i].Filename = filename
+			}
+			files[fileID] = f
+			log.Printf("[DOCUMENT MIGRATE] File: %s | File ID: %s | Versions: %d", filename, fileID, len(f.Versions))
+		}
+		r.data.Files = files
+		r.data.FileIDs = true
+		if err := r.saveLocked(); err != nil {
+			return nil, err
+		}
+	}
+	for fileID, f := range r.data.Files {
+		for _, d := range f.Versions {
+			if d.ID != "" {
+				r.byID[d.ID] = fileID
+			}
+		}
+	}
+	return r, nil
+}
+
+// saveLocked persists the registry. Callers must hold r.mu.
+func (r *documentRegistry) saveLocked() error {
+	data, err := json.MarshalIndent(r.data, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode documents: %w", err)
+	}
+	return writeFileAtomic(r.path, data)
+}
+
+func (r *documentRegistry) fileLocked(fileID string) *fileVersions {
+	f, ok := r.data.Files[fileID]
+	if !ok {
+		f = &fileVersions{}
+		r.data.Files[fileID] = f
+	}
+	return f
+}
+
+// withLatest returns a copy of the versions of f with Latest filled in.
+func (f *fileVersions) withLatest() []Document {
+	docs := make([]Document, len(f.Versions))
+	for i, d := range f.Versions {
+		d.Latest = d.Version == f.Latest
+		docs[i] = d
+	}
+	return docs
+}
+
+// reserve hands out the next version number of a file. A file with no
+// versions yet starts at 1 and is only recorded once a version is added.
+func (r *documentRegistry) reserve(fileID string) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	f, ok := r.data.Files[fileID]
+	if !ok {
+		return 1, nil
+	}
+	f.Next++
+	if err := r.saveLocked(); err != nil {
+		f.Next--
+		return 0, err
+	}
+	return f.Next, nil
+}
+
+// latest returns the latest version of a file.
+func (r *documentRegistry) latest(fileID string) (Document, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if f, ok := r.data.Files[fileID]; ok {
+		for _, d := range f.withLatest() {
+			if d.Latest {
+				return d, true
+			}
+		}
+	}
+	return Document{}, false
+}
+
+// list returns the versions of a file, oldest first.
+func (r *documentRegistry) list(fileID string) ([]Document, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	f, ok := r.data.Files[fileID]
+	if !ok || len(f.Versions) == 0 {
+		return nil, false
+	}
+	return f.withLatest(), true
+}
+
+// hasFile reports whether fileID names a file with at least one version.
+func (r *documentRegistry) hasFile(fileID string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	f, ok := r.data.Files[fileID]
+	return ok && len(f.Versions) > 0
+}
+
+// filesNamed returns the IDs of the files whose latest version is called
+// filename, in no particular order.
+func (r *documentRegistry) filesNamed(filename string) []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var ids []string
+	for fileID, f := range r.data.Files {
+		for _, d := range f.withLatest() {
+			if d.Latest && d.Filename == filename {
+				ids = append(ids, fileID)
+			}
+		}
+	}
+	return ids
+}
+
+// withHash returns the latest version of a file whose content has the given
+// hash, preferring the oldest upload, or false if there is none.
+func (r *documentRegistry) withHash(hash string) (Document, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var found Document
+	for _, f := range r.data.Files {
+		for _, d := range f.withLatest() {
+			if d.Latest && d.ContentHash == hash && (found.ID == "" || d.UploadedAt.Before(found.UploadedAt)) {
+				found = d
+			}
+		}
+	}
+	return found, found.ID != ""
+}
+
+// all returns every document ordered by filename, file and version. With
+// latestOnly only the latest version of each file is returned.
+func (r *documentRegistry) all(latestOnly bool) []Document {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var docs []Document
+	for _, f := range r.data.Files {
+		for _, d := range f.withLatest() {
+			if d.Latest || !latestOnly {
+				docs = append(docs, d)
+			}
+		}
+	}
+	sort.Slice(docs, func(i, j int) bool {
+		if docs[i].Filename != docs[j].Filename {
+			return docs[i].Filename < docs[j].Filename
+		}
+		if docs[i].FileID != docs[j].FileID {
+			return docs[i].FileID < docs[j].FileID
+		}
+		return docs[i].Version < docs[j].Version
+	})
+	return docs
+}
+
+// get returns the document with the given ID.
+func (r *documentRegistry) get(id string) (Document, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	f, ok := r.data.Files[r.byID[id]]
+	if !ok {
+		return Document{}, false
+	}
+	for _, d := range f.withLatest() {
+		if d.ID == id {
+			return d, true
+		}
+	}
+	return Document{}, false
+}
+
+// add records a completed document, replacing an earlier record of the same
+// version, and makes it the latest version of its file unless a newer version
+// is latest already.
+func (r *documentRegistry) add(doc Document) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	doc.Latest = false
+	doc.UpdatedAt = time.Now()
+	f := r.fileLocked(doc.FileID)
+	f.Versions = slices.DeleteFunc(f.Versions, func(old Document) bool { return old.Version == doc.Version })
+	f.Versions = append(f.Versions, doc)
+	sort.Slice(f.Versions, func(i, j int) bool { return f.Versions[i].Version < f.Versions[j].Version })
+	f.Next = max(f.Next, doc.Version)
+	if doc.Version > f.Latest {
+		f.Latest = doc.Version
+	}
+	r.byID[doc.ID] = doc.FileID
+	return r.saveLocked()
+}
+
+// setID gives a document recorded before documents had IDs its ID.
+func (r *documentRegistry) setID(fileID string, version int, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if f, ok := r.data.Files[fileID]; ok {
+		for i := range f.Versions {
+			if f.Versions[i].Version == version {
+				f.Versions[i].ID = id
+				f.Versions[i].UpdatedAt = time.Now()
+				r.byID[id] = fileID
+				return r.saveLocked()
+			}
+		}
+	}
+	return errVersionNotFound
+}
+
+func (r *documentRegistry) setLatest(fileID string, version int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	f, ok := r.data.Files[fileID]
+	if !ok {
+		return errVersionNotFound
+	}
+	f.Latest = version
+	for i := range f.Versions {
+		if f.Versions[i].Version == version {
+			f.Versions[i].UpdatedAt = time.Now()
+		}
+	}
+	return r.saveLocked()
+}
+
+func (r *documentRegistry) remove(fileID string, version int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	f, ok := r.data.Files[fileID]
+	if !ok {
+		return errVersionNotFound
+	}
+	for i, d := range f.Versions {
+		if d.Version == version {
+			delete(r.byID, d.ID)
+			f.Versions = append(f.Versions[:i], f.Versions[i+1:]...)
+			return r.saveLocked()
+		}
+	}
+	return errVersionNotFound
+}
+
+// removeFile forgets a file and its documents.
+func (r *documentRegistry) removeFile(fileID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if f, ok := r.data.Files[fileID]; ok {
+		for _, d := range f.Versions {
+			delete(r.byID, d.ID)
+		}
+	}
+	delete(r.data.Files, fileID)
+	return r.saveLocked()
+}
+
+func (r *documentRegistry) reset() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.data.Files = make(map[string]*fileVersions)
+	r.byID = make(map[string]string)
+	return r.saveLocked()
+}
+
+func (r *documentRegistry) migrated() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.data.Migrated
+}
+
+func (r *documentRegistry) setMigrated() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.data.Migrated = true
+	return r.saveLocked()
+}
+
+// migrateDocumentIDs gives documents recorded before documents had IDs an ID
+// and tags their chunks with it. Filenames were unique back then, so the
+// filename and version find their chunks.
+func (h *Handler) migrateDocumentIDs(ctx context.Context) error {
+	for _, doc := range h.documents.all(false) {
+		if doc.ID != "" {
+			continue
+		}
+		id := uuid.NewString()
+		if err := h.store.SetMetadata(ctx, Filter{"filename": doc.Filename, "version": doc.Version}, map[string]interface{}{"document_id": id}); err != nil {
+			return fmt.Errorf("failed to tag %s version %d: %w", doc.Filename, doc.Version, err)
+		}
+		if err := h.documents.setID(doc.FileID, doc.Version, id); err != nil {
+			return err
+		}
+		log.Printf("[DOCUMENT MIGRATE] File: %s | Version: %d | Document: %s", doc.Filename, doc.Version, id)
+	}
+	return nil
+}
+
+// deleteDocumentLocked removes a document and its chunks. When it was the
+// latest version of its file the newest remaining version takes its place.
+// Callers must hold h.documentsMu.
+func (h *Handler) deleteDocumentLocked(ctx context.Context, doc Document) error {
+	if err := h.deleteVersionLocked(ctx, doc); err != nil {
+		return err
+	}
+	if !doc.Latest {
+		return nil
+	}
+
+	remaining, ok := h.documents.list(doc.FileID)
+	if !ok {
+		return h.documents.removeFile(doc.FileID)
+	}
+	newest := remaining[len(remaining)-1]
+	if err := h.store.SetMetadata(ctx, Filter{"document_id": newest.ID}, map[string]interface{}{"latest": true}); err != nil {
+		return fmt.Errorf("failed to promote version %d: %w", newest.Version, err)
+	}
+	return h.documents.setLatest(doc.FileID, newest.Version)
+}
+
+// HandleDocuments lists stored documents (GET, optionally ?filename= or
+// ?file_id=) and accepts uploads (POST, same form as /api/upload).
+func (h *Handler) HandleDocuments(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		h.HandleUpload(w, r)
+		return
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	docs := h.documents.all(r.URL.Query().Get("latest") == "true")
+	if filename := r.URL.Query().Get("filename"); filename != "" {
+		docs = slices.DeleteFunc(docs, func(d Document) bool { return d.Filename != filename })
+	}
+	if fileID := r.URL.Query().Get("file_id"); fileID != "" {
+		docs = slices.DeleteFunc(docs, func(d Document) bool { return d.FileID != fileID })
+	}
+	if author := r.URL.Query().Get("author"); author != "" {
+		docs = slices.DeleteFunc(docs, func(d Document) bool { return d.Author != author })
+	}
+	if docs == nil {
+		docs = []Document{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"documents": docs})
+}
+
+// HandleDocument serves a single document by ID:
+//
+//	GET    /api/documents/{id}        document record
+//	PATCH  /api/documents/{id}        {"latest": true} makes it the latest version again
+//	DELETE /api/documents/{id}        delete it (?all_versions=true deletes its whole file)
+//	GET    /api/documents/{id}/file   original file (?download=true as attachment)
+func (h *Handler) HandleDocument(w http.ResponseWriter, r *http.Request) {
+	id, rest, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/api/documents/"), "/")
+	if id == "" || (rest != "" && rest != "file") {
+		http.NotFound(w, r)
+		return
+	}
+
+	doc, ok := h.documents.get(id)
+	if !ok {
+		http.Error(w, errDocumentNotFound.Error(), http.StatusNotFound)
+		return
+	}
+
+	if rest == "file" {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		h.serveOriginal(w, r, doc)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(doc)
+	case http.MethodPatch:
+		h.patchDocument(w, r, doc)
+	case http.MethodDelete:
+		if r.URL.Query().Get("all_versions") == "true" {
+			h.deleteFile(w, r, doc.FileID)
+			return
+		}
+		h.deleteDocument(w, r, doc)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *Handler) patchDocument(w http.ResponseWriter, r *http.Request, doc Document) {
+	var req struct {
+		Latest *bool `json:"latest"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+	if req.Latest == nil || !*req.Latest {
+		http.Error(w, `only {"latest": true} can be set; delete the document or roll back to another version instead`, http.StatusBadRequest)
+		return
+	}
+
+	h.documentsMu.Lock()
+	err := h.setLatestLocked(r.Context(), doc)
+	h.documentsMu.Unlock()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	doc, _ = h.documents.get(doc.ID)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(doc)
+}
+
+func (h *Handler) deleteDocument(w http.ResponseWriter, r *http.Request, doc Document) {
+	h.documentsMu.Lock()
+	defer h.documentsMu.Unlock()
+
+	// Re-read under the lock in case the latest version changed meanwhile
+	doc, ok := h.documents.get(doc.ID)
+	if !ok {
+		http.Error(w, errDocumentNotFound.Error(), http.StatusNotFound)
+		return
+	}
+	if err := h.deleteDocumentLocked(r.Context(), doc); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("[DOCUMENT DELETE] Document: %s | File: %s | Version: %d", doc.ID, doc.Filename, doc.Version)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":   "deleted",
+		"id":       doc.ID,
+		"file_id":  doc.FileID,
+		"filename": doc.Filename,
+		"version":  doc.Version,
+	})
+}
+
+// serveOriginal streams the original uploaded file of a document. PDF viewers
+// honour a #page=N fragment on the URL to open it at a search hit's page.
+// Only PDFs are ever served inline: other formats, HTML above all, could run
+// script on the app's origin, so they are always downloaded, sandboxed and
+// without content sniffing.
+func (h *Handler) serveOriginal(w http.ResponseWriter, r *http.Request, doc Document) {
+	if doc.File == "" {
+		http.Error(w, "original file was not kept for this document", http.StatusNotFound)
+		return
+	}
+
+	blob, size, err := h.blobs.Get(r.Context(), doc.File)
+	if errors.Is(err, errBlobNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("[BLOB ERROR] File: %s | Document: %s | Failed to read original: %v", doc.Filename, doc.ID, err)
+		http.Error(w, fmt.Sprintf("failed to read file: %v", err), http.StatusInternalServerError)
+		return
+	}
+	defer blob.Close()
+
+	contentType := doc.ContentType
+	if contentType == "" {
+		contentType = MimePDF // stored when only PDFs could be uploaded
+	}
+	disposition := "inline"
+	if contentType != MimePDF || r.URL.Query().Get("download") == "true" {
+		disposition = "attachment"
+	}
+	if contentType != MimePDF {
+		w.Header().Set("Content-Security-Policy", "sandbox")
+		contentType = "application/octet-stream"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": doc.Filename}))
+	if size >= 0 {
+		w.Header().Set("Content-Length", strconv.FormatInt(size, 10))
+	}
+	if _, err := io.Copy(w, blob); err != nil {
+		log.Printf("[BLOB ERROR] File: %s | Document: %s | Download interrupted: %v", doc.Filename, doc.ID, err)
+	}
+}
@@ -0,0 +1,25 @@
+package document
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestDocumentRegistryAddOutOfOrder(t *testing.T) {
+	r, err := newDocumentRegistry(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Versions 2 and 3 were reserved in order but 3 finished first
+	for _, v := range []int{1, 3, 2} {
+		if err := r.add(Document{ID: "doc-" + strconv.Itoa(v), FileID: "f", Filename: "a.txt", Version: v}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if latest, _ := r.latest("f"); latest.Version != 3 {
+		t.Errorf("latest = version %d, want 3", latest.Version)
+	}
+	if versions, _ := r.list("f"); len(versions) != 3 {
+		t.Errorf("%d versions recorded, want 3", len(versions))
+	}
+}
@@ -0,0 +1,405 @@
+package document
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	wordNS   = "http://schemas.openxmlformats.org/wordprocessingml/2006/main"
+	markupNS = "http://schemas.openxmlformats.org/markup-compatibility/2006"
+
+	// maxZipPart bounds how much of one file inside a zip archive is read,
+	// so a small upload cannot decompress into gigabytes
+	maxZipPart = 256 << 20
+)
+
+var headingStyleName = regexp.MustCompile(`^(?i)heading ([1-9])$`)
+
+// DocxExtractor extracts Word (OOXML) documents. Paragraphs are separated by
+// blank lines and each table row becomes a line with its cells joined by
+// " | ". Paragraphs in heading styles start sections titled with their
+// heading path, and the core properties provide the title, author, subject
+// and creation date.
+type DocxExtractor struct{}
+
+func (DocxExtractor) Name() string { return "docx" }
+
+func (DocxExtractor) Extract(ctx context.Context, path, filename string, progress func(string)) (*Content, error) {
+	if progress != nil {
+		progress("Reading Word document...")
+	}
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read DOCX: %w", err)
+	}
+	defer zr.Close()
+
+	styles, err := readDocxStyles(&zr.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read DOCX styles: %w", err)
+	}
+	info, err := readDocxCore(&zr.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read DOCX properties: %w", err)
+	}
+
+	part, err := openZipPart(&zr.Reader, "word/document.xml")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read DOCX: %w", err)
+	}
+	defer part.Close()
+	content, err := parseDocxBody(ctx, part, styles)
+	if err != nil {
+		return nil, err
+	}
+
+	if info.Title == "" {
+		info.Title = content.Info.Title
+	}
+	content.Info = info
+	return content, nil
+}
+
+// docxStyle is what matters about a paragraph style: the heading level it
+// gives a paragraph (0 for body text), or whether it is the title style.
+type docxStyle struct {
+	level int
+	title bool
+}
+
+// readDocxStyles maps the paragraph style IDs of word/styles.xml to heading
+// levels. Styles are recognised by their built-in names ("heading 1",
+// "Title"), which unlike the IDs are not localised, by their outline level,
+// or by the style they are based on. Without a styles part the default IDs
+// ("Heading1", "Title") are assumed.
+func readDocxStyles(zr *zip.Reader) (map[string]docxStyle, error) {
+	styles := make(map[string]docxStyle)
+	for i := 1; i <= 9; i++ {
+		styles["Heading"+strconv.Itoa(i)] = docxStyle{level: i}
+	}
+	styles["Title"] = docxStyle{title: true}
+
+	var doc struct {
+		Styles []struct {
+			Type    string `xml:"type,attr"`
+			ID      string `xml:"styleId,attr"`
+			Name    val    `xml:"name"`
+			BasedOn val    `xml:"basedOn"`
+			Outline *val   `xml:"pPr>outlineLvl"`
+		} `xml:"style"`
+	}
+	err := decodeZipXML(zr, "word/styles.xml", &doc)
+	if errors.Is(err, errZipPartMissing) {
+		return styles, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	basedOn := make(map[string]string)
+	for _, s := range doc.Styles {
+		if s.Type != "paragraph" || s.ID == "" {
+			continue
+		}
+		delete(styles, s.ID)
+		switch m := headingStyleName.FindStringSubmatch(s.Name.Val); {
+		case m != nil:
+			styles[s.ID] = docxStyle{level: int(m[1][0] - '0')}
+		case strings.EqualFold(s.Name.Val, "title"):
+			styles[s.ID] = docxStyle{title: true}
+		case s.Outline != nil:
+			// Outline level 9 is body text
+			if lvl, err := strconv.Atoi(s.Outline.Val); err == nil && lvl >= 0 && lvl < 9 {
+				styles[s.ID] = docxStyle{level: lvl + 1}
+			}
+		default:
+			basedOn[s.ID] = s.BasedOn.Val
+		}
+	}
+	// Inherit from base styles, bounded in case of cycles
+	for id, base := range basedOn {
+		for n := 0; base != "" && n < 16; n++ {
+			if style, ok := styles[base]; ok {
+				styles[id] = style
+				break
+			}
+			base = basedOn[base]
+		}
+	}
+	return styles, nil
+}
+
+// val is an element whose value is its w:val attribute.
+type val struct {
+	Val string `xml:"val,attr"`
+}
+
+// readDocxCore reads the title, author, subject and creation date from the
+// core properties in docProps/core.xml, if there are any.
+func readDocxCore(zr *zip.Reader) (DocumentInfo, error) {
+	var info DocumentInfo
+	var core struct {
+		Title   string `xml:"http://purl.org/dc/elements/1.1/ title"`
+		Creator string `xml:"http://purl.org/dc/elements/1.1/ creator"`
+		Subject string `xml:"http://purl.org/dc/elements/1.1/ subject"`
+		Created string `xml:"http://purl.org/dc/terms/ created"`
+	}
+	err := decodeZipXML(zr, "docProps/core.xml", &core)
+	if errors.Is(err, errZipPartMissing) {
+		return info, nil
+	}
+	if err != nil {
+		return info, err
+	}
+	info.Title = strings.TrimSpace(core.Title)
+	info.Author = strings.TrimSpace(core.Creator)
+	info.Subject = strings.TrimSpace(core.Subject)
+	if created, err := time.Parse(time.RFC3339, strings.TrimSpace(core.Created)); err == nil {
+		info.Created = created.Format(time.RFC3339)
+	}
+	return info, nil
+}
+
+// docxTable collects the rows of a table being read. Nested tables are
+// flattened into the cell that holds them.
+type docxTable struct {
+	rows []string
+	row  []string
+	cell []string // paragraphs of the current cell
+}
+
+// parseDocxBody reads the paragraphs and tables of word/document.xml in
+// document order. The first paragraph in the title style, or else the first
+// top-level heading, becomes the title.
+func parseDocxBody(ctx context.Context, r io.Reader, styles map[string]docxStyle) (*Content, error) {
+	content := &Content{KeepLineBreaks: true}
+	var (
+		buf        strings.Builder
+		path       headingPath
+		headingH1  string
+		tables     []*docxTable
+		paragraphs []*strings.Builder // open paragraphs; text boxes nest them
+		style      string             // style of the innermost open paragraph
+		outline    = -1               // outline level set on the paragraph itself
+		inText     bool
+	)
+
+	write := func(block string) {
+		block = strings.TrimSpace(block)
+		if block == "" {
+			return
+		}
+		if buf.Len() > 0 {
+			buf.WriteString("\n\n")
+		}
+		buf.WriteString(block)
+	}
+
+	d := xml.NewDecoder(r)
+	for n := 0; ; n++ {
+		if n%1000 == 0 {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+		}
+		tok, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse DOCX: %w", err)
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if t.Name.Space == markupNS && t.Name.Local == "Fallback" {
+				// Alternate content repeats what the choice before it says
+				if err := d.Skip(); err != nil {
+					return nil, fmt.Errorf("failed to parse DOCX: %w", err)
+				}
+				continue
+			}
+			if t.Name.Space != wordNS {
+				continue
+			}
+			var p *strings.Builder
+			if len(paragraphs) > 0 {
+				p = paragraphs[len(paragraphs)-1]
+			}
+			switch t.Name.Local {
+			case "p":
+				paragraphs = append(paragraphs, &strings.Builder{})
+				style, outline = "", -1
+			case "pStyle":
+				style = attr(t, "val")
+			case "outlineLvl":
+				if lvl, err := strconv.Atoi(attr(t, "val")); err == nil {
+					outline = lvl
+				}
+			case "t":
+				inText = p != nil
+			case "tab":
+				if p != nil {
+					p.WriteByte('\t')
+				}
+			case "br", "cr":
+				if p != nil {
+					p.WriteByte('\n')
+				}
+			case "tbl":
+				tables = append(tables, &docxTable{})
+			case "tr":
+				if len(tables) > 0 {
+					tables[len(tables)-1].row = nil
+				}
+			case "tc":
+				if len(tables) > 0 {
+					tables[len(tables)-1].cell = nil
+				}
+			}
+
+		case xml.CharData:
+			if inText {
+				paragraphs[len(paragraphs)-1].Write(t)
+			}
+
+		case xml.EndElement:
+			if t.Name.Space != wordNS {
+				continue
+			}
+			switch t.Name.Local {
+			case "t":
+				inText = false
+			case "p":
+				if len(paragraphs) == 0 {
+					continue
+				}
+				text := strings.TrimSpace(paragraphs[len(paragraphs)-1].String())
+				paragraphs = paragraphs[:len(paragraphs)-1]
+				switch {
+				case text == "":
+				case len(paragraphs) > 0:
+					// A text box inside a paragraph reads as part of it
+					parent := paragraphs[len(paragraphs)-1]
+					parent.WriteByte(' ')
+					parent.WriteString(text)
+				case len(tables) > 0:
+					table := tables[len(tables)-1]
+					table.cell = append(table.cell, text)
+				default:
+					s := styles[style]
+					level := s.level
+					if outline >= 0 && outline < 9 {
+						level = outline + 1
+					}
+					if s.title && content.Info.Title == "" {
+						content.Info.Title = text
+					}
+					if level > 0 {
+						if level == 1 && headingH1 == "" {
+							headingH1 = text
+						}
+						offset := buf.Len()
+						if offset > 0 {
+							offset += 2
+						}
+						content.Sections = append(content.Sections, Section{Title: path.enter(level, text), Offset: offset})
+					}
+					write(text)
+				}
+			case "tc":
+				if len(tables) > 0 {
+					table := tables[len(tables)-1]
+					table.row = append(table.row, strings.Join(table.cell, " "))
+				}
+			case "tr":
+				if len(tables) > 0 {
+					table := tables[len(tables)-1]
+					if row := strings.Join(table.row, " | "); strings.Trim(row, " |") != "" {
+						table.rows = append(table.rows, row)
+					}
+				}
+			case "tbl":
+				if len(tables) == 0 {
+					continue
+				}
+				table := tables[len(tables)-1]
+				tables = tables[:len(tables)-1]
+				if len(tables) > 0 {
+					parent := tables[len(tables)-1]
+					parent.cell = append(parent.cell, strings.Join(table.rows, "; "))
+				} else {
+					write(strings.Join(table.rows, "\n"))
+				}
+			}
+		}
+	}
+
+	if content.Info.Title == "" {
+		content.Info.Title = headingH1
+	}
+	content.Text = buf.String()
+	return content, nil
+}
+
+// attr returns the value of the attribute of e with the given local name.
+func attr(e xml.StartElement, local string) string {
+	for _, a := range e.Attr {
+		if a.Name.Local == local {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+var errZipPartMissing = errors.New("missing from archive")
+
+// openZipPart opens the file called name inside a zip archive. Reading it
+// fails once more than maxZipPart bytes have been decompressed.
+func openZipPart(zr *zip.Reader, name string) (io.ReadCloser, error) {
+	f, err := zr.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, errZipPartMissing)
+	}
+	return &limitedPart{ReadCloser: f, name: name, left: maxZipPart}, nil
+}
+
+type limitedPart struct {
+	io.ReadCloser
+	name string
+	left int64
+}
+
+func (p *limitedPart) Read(b []byte) (int, error) {
+	if p.left <= 0 {
+		return 0, fmt.Errorf("%s is larger than %d bytes", p.name, maxZipPart)
+	}
+	if int64(len(b)) > p.left {
+		b = b[:p.left]
+	}
+	n, err := p.ReadCloser.Read(b)
+	p.left -= int64(n)
+	return n, err
+}
+
+// decodeZipXML decodes the XML file called name inside a zip archive into v.
+func decodeZipXML(zr *zip.Reader, name string, v interface{}) error {
+	part, err := openZipPart(zr, name)
+	if err != nil {
+		return err
+	}
+	defer part.Close()
+	if err := xml.NewDecoder(part).Decode(v); err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,191 @@
+package document
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+// docxDocument wraps body in a word/document.xml part.
+func docxDocument(body string) string {
+	return `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` +
+		`<w:document xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main"` +
+		` xmlns:mc="http://schemas.openxmlformats.org/markup-compatibility/2006"><w:body>` +
+		body + `</w:body></w:document>`
+}
+
+// docxPara is a paragraph in the given style, or in none if style is empty.
+func docxPara(style, text string) string {
+	var props string
+	if style != "" {
+		props = `<w:pPr><w:pStyle w:val="` + style + `"/></w:pPr>`
+	}
+	return `<w:p>` + props + `<w:r><w:t xml:space="preserve">` + text + `</w:t></w:r></w:p>`
+}
+
+// docxTableXML is a table with one paragraph in each cell.
+func docxTableXML(rows ...[]string) string {
+	var b strings.Builder
+	b.WriteString(`<w:tbl>`)
+	for _, row := range rows {
+		b.WriteString(`<w:tr>`)
+		for _, cell := range row {
+			b.WriteString(`<w:tc>` + docxPara("", cell) + `</w:tc>`)
+		}
+		b.WriteString(`</w:tr>`)
+	}
+	b.WriteString(`</w:tbl>`)
+	return b.String()
+}
+
+func TestParseDocxBody(t *testing.T) {
+	defaults := map[string]docxStyle{"Heading1": {level: 1}, "Heading2": {level: 2}, "Heading3": {level: 3}, "Title": {title: true}}
+
+	tests := []struct {
+		name     string
+		styles   map[string]docxStyle
+		body     string
+		text     string
+		title    string
+		sections []wantSection
+	}{
+		{
+			name: "heading paths",
+			body: docxPara("Heading1", "Install") + docxPara("", "Intro.") +
+				docxPara("Heading2", "Linux") + docxPara("Heading3", "Proxy") +
+				docxPara("Heading2", "macOS") + docxPara("Heading1", "Usage"),
+			text:  "Install\n\nIntro.\n\nLinux\n\nProxy\n\nmacOS\n\nUsage",
+			title: "Install",
+			sections: []wantSection{
+				{"Install", "Install"},
+				{"Install > Linux", "Linux"},
+				{"Install > Linux > Proxy", "Proxy"},
+				{"Install > macOS", "macOS"},
+				{"Usage", "Usage"},
+			},
+		},
+		{
+			name:  "title style wins over the first heading",
+			body:  docxPara("Heading1", "Chapter") + docxPara("Title", "The Book"),
+			text:  "Chapter\n\nThe Book",
+			title: "The Book",
+			sections: []wantSection{
+				{"Chapter", "Chapter"},
+			},
+		},
+		{
+			name:   "localised style IDs",
+			styles: map[string]docxStyle{"berschrift1": {level: 1}},
+			body:   docxPara("berschrift1", "Einleitung") + docxPara("Heading1", "Not a heading here"),
+			text:   "Einleitung\n\nNot a heading here",
+			title:  "Einleitung",
+			sections: []wantSection{
+				{"Einleitung", "Einleitung"},
+			},
+		},
+		{
+			name:  "outline level on the paragraph",
+			body:  `<w:p><w:pPr><w:outlineLvl w:val="1"/></w:pPr><w:r><w:t>Outlined</w:t></w:r></w:p>`,
+			text:  "Outlined",
+			title: "",
+			sections: []wantSection{
+				{"Outlined", "Outlined"},
+			},
+		},
+		{
+			name: "tables",
+			body: docxPara("Heading1", "Prices") +
+				docxTableXML([]string{"Item", "Price"}, []string{"Tea", "2"}, []string{"", ""}, []string{"Cake", "3"}) +
+				docxPara("", "After."),
+			text:  "Prices\n\nItem | Price\nTea | 2\nCake | 3\n\nAfter.",
+			title: "Prices",
+			sections: []wantSection{
+				{"Prices", "Prices"},
+			},
+		},
+		{
+			name: "nested table is flattened into its cell",
+			body: `<w:tbl><w:tr><w:tc>` + docxPara("", "Outer") + `</w:tc><w:tc>` +
+				docxTableXML([]string{"a", "b"}, []string{"c", "d"}) + `</w:tc></w:tr></w:tbl>`,
+			text: "Outer | a | b; c | d",
+		},
+		{
+			name: "tabs, breaks and runs",
+			body: `<w:p><w:r><w:t>One</w:t><w:tab/><w:t>two</w:t></w:r><w:r><w:br/><w:t xml:space="preserve">three </w:t></w:r><w:r><w:t>four</w:t></w:r></w:p>`,
+			text: "One\ttwo\nthree four",
+		},
+		{
+			name: "alternate content is read once",
+			body: `<w:p><w:r><mc:AlternateContent><mc:Choice><w:t>Choice</w:t></mc:Choice>` +
+				`<mc:Fallback><w:t>Fallback</w:t></mc:Fallback></mc:AlternateContent></w:r></w:p>`,
+			text: "Choice",
+		},
+		{
+			name: "empty paragraphs are dropped",
+			body: docxPara("", "") + docxPara("", "Text") + docxPara("", "  "),
+			text: "Text",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			styles := tt.styles
+			if styles == nil {
+				styles = defaults
+			}
+			content, err := parseDocxBody(context.Background(), strings.NewReader(docxDocument(tt.body)), styles)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if content.Text != tt.text {
+				t.Errorf("text = %q, want %q", content.Text, tt.text)
+			}
+			if content.Info.Title != tt.title {
+				t.Errorf("title = %q, want %q", content.Info.Title, tt.title)
+			}
+			checkSections(t, content.Text, content.Sections, tt.sections)
+		})
+	}
+}
+
+func TestDocxExtractor(t *testing.T) {
+	styles := `<?xml version="1.0" encoding="UTF-8"?>
+<w:styles xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main">
+  <w:style w:type="paragraph" w:styleId="berschrift1"><w:name w:val="heading 1"/></w:style>
+  <w:style w:type="paragraph" w:styleId="Titel"><w:name w:val="Title"/></w:style>
+  <w:style w:type="paragraph" w:styleId="Kapitel"><w:name w:val="Kapitel"/><w:basedOn w:val="berschrift1"/></w:style>
+  <w:style w:type="paragraph" w:styleId="Gliederung"><w:name w:val="Gliederung"/><w:pPr><w:outlineLvl w:val="1"/></w:pPr></w:style>
+  <w:style w:type="paragraph" w:styleId="Heading1"><w:name w:val="Normal Text"/></w:style>
+</w:styles>`
+	core := `<?xml version="1.0" encoding="UTF-8"?>
+<cp:coreProperties xmlns:cp="http://schemas.openxmlformats.org/package/2006/metadata/core-properties"
+  xmlns:dc="http://purl.org/dc/elements/1.1/" xmlns:dcterms="http://purl.org/dc/terms/">
+  <dc:creator>Jane Doe</dc:creator>
+  <dc:subject>Handbook</dc:subject>
+  <dcterms:created>2024-03-01T10:00:00Z</dcterms:created>
+</cp:coreProperties>`
+	body := docxPara("Titel", "Handbuch") + docxPara("berschrift1", "Einleitung") +
+		docxPara("Gliederung", "Ziele") + docxPara("Kapitel", "Anhang") + docxPara("Heading1", "Plain")
+
+	path := writeTemp(t, "handbook.docx", zipBytes(t,
+		zipFile{"word/document.xml", docxDocument(body)},
+		zipFile{"word/styles.xml", styles},
+		zipFile{"docProps/core.xml", core},
+	))
+	content, err := DocxExtractor{}.Extract(context.Background(), path, "handbook.docx", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "Handbuch\n\nEinleitung\n\nZiele\n\nAnhang\n\nPlain"; content.Text != want {
+		t.Errorf("text = %q, want %q", content.Text, want)
+	}
+	// Without a title in the core properties the title style provides it
+	want := DocumentInfo{Title: "Handbuch", Author: "Jane Doe", Subject: "Handbook", Created: "2024-03-01T10:00:00Z"}
+	if content.Info != want {
+		t.Errorf("info = %+v, want %+v", content.Info, want)
+	}
+	checkSections(t, content.Text, content.Sections, []wantSection{
+		{"Einleitung", "Einleitung"},
+		{"Einleitung > Ziele", "Ziele"},
+		{"Anhang", "Anhang"},
+	})
+}
@@ -0,0 +1,232 @@
+package document
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync/atomic"
+
+	"github.com/akhilmk/gowise/internal/resilient"
+)
+
+// Embedding backends selectable per model via EMBEDDING_BACKENDS.
+const (
+	BackendOllama = "ollama"
+	BackendOpenAI = "openai"
+)
+
+// Embedder turns text into embedding vectors.
+type Embedder interface {
+	// Embed returns one vector per input text, in input order.
+	Embed(ctx context.Context, texts []string) ([][]float32, error)
+	// Dimensions reports the vector size, or 0 until the first successful call.
+	Dimensions() int
+	// Name returns the model name the embedder was created for.
+	Name() string
+}
+
+// OllamaEmbedder calls Ollama's /api/embed endpoint, sending all texts of a
+// call as one batch.
+type OllamaEmbedder struct {
+	baseURL string
+	model   string
+	client  *resilient.Client
+	dims    atomic.Int64
+}
+
+// NewOllamaEmbedder creates an embedder for the given Ollama model that sends
+// its requests through client.
+func NewOllamaEmbedder(baseURL, model string, client *resilient.Client) *OllamaEmbedder {
+	return &OllamaEmbedder{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		model:   model,
+		client:  client,
+	}
+}
+
+func (e *OllamaEmbedder) Name() string    { return e.model }
+func (e *OllamaEmbedder) Dimensions() int { return int(e.dims.Load()) }
+
+func (e *OllamaEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	if len(texts) == 0 {
+		return nil, nil
+	}
+
+	reqBody, _ := json.Marshal(EmbeddingRequest{
+		Model: e.model,
+		Input: texts,
+	})
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.baseURL+"/api/embed", bytes.NewReader(reqBody))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("http post error: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("ollama returned status %d: %s", resp.StatusCode, string(body))
+	}
+
+	var res EmbeddingResponse
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	if len(res.Embeddings) != len(texts) {
+		return nil, fmt.Errorf("ollama returned %d embeddings for %d inputs", len(res.Embeddings), len(texts))
+	}
+	for i, vec := range res.Embeddings {
+		if len(vec) == 0 {
+			return nil, fmt.Errorf("ollama returned an empty embedding at index %d for model %s", i, e.model)
+		}
+	}
+
+	e.dims.Store(int64(len(res.Embeddings[0])))
+	return res.Embeddings, nil
+}
+
+// OpenAIEmbedder calls an OpenAI-compatible /v1/embeddings endpoint
+// (llama.cpp server, vLLM, LocalAI, ...).
+type OpenAIEmbedder struct {
+	baseURL string
+	apiKey  string
+	model   string
+	client  *resilient.Client
+	dims    atomic.Int64
+}
+
+// NewOpenAIEmbedder creates an embedder for the given model that sends its
+// requests through client. apiKey may be empty for servers that do not
+// require authentication.
+func NewOpenAIEmbedder(baseURL, apiKey, model string, client *resilient.Client) *OpenAIEmbedder {
+	return &OpenAIEmbedder{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		apiKey:  apiKey,
+		model:   model,
+		client:  client,
+	}
+}
+
+func (e *OpenAIEmbedder) Name() string    { return e.model }
+func (e *OpenAIEmbedder) Dimensions() int { return int(e.dims.Load()) }
+
+type openAIEmbeddingRequest struct {
+	Model string   `json:"model"`
+	Input []string `json:"input"`
+}
+
+type openAIEmbeddingResponse struct {
+	Data []struct {
+		Index     int       `json:"index"`
+		Embedding []float32 `json:"embedding"`
+	} `json:"data"`
+}
+
+func (e *OpenAIEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	if len(texts) == 0 {
+		return nil, nil
+	}
+
+	reqBody, _ := json.Marshal(openAIEmbeddingRequest{
+		Model: e.model,
+		Input: texts,
+	})
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.baseURL+"/v1/embeddings", bytes.NewReader(reqBody))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if e.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+e.apiKey)
+	}
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("http post error: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("embeddings endpoint returned status %d: %s", resp.StatusCode, string(body))
+	}
+
+	var res openAIEmbeddingResponse
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	if len(res.Data) != len(texts) {
+		return nil, fmt.Errorf("embeddings endpoint returned %d vectors for %d inputs", len(res.Data), len(texts))
+	}
+
+	// Servers may return data out of order; place each vector by its index.
+	out := make([][]float32, len(texts))
+	for _, d := range res.Data {
+		if d.Index < 0 || d.Index >= len(out) || len(d.Embedding) == 0 {
+			return nil, fmt.Errorf("embeddings endpoint returned an invalid entry at index %d", d.Index)
+		}
+		out[d.Index] = d.Embedding
+	}
+
+	e.dims.Store(int64(len(out[0])))
+	return out, nil
+}
+
+// parseModelBackends parses "model=backend" pairs separated by commas.
+func parseModelBackends(value string) map[string]string {
+	backends := make(map[string]string)
+	for _, pair := range strings.Split(value, ",") {
+		model, backend, ok := strings.Cut(pair, "=")
+		if !ok {
+			continue
+		}
+		model = strings.TrimSpace(model)
+		backend = strings.ToLower(strings.TrimSpace(backend))
+		if model != "" && backend != "" {
+			backends[model] = backend
+		}
+	}
+	return backends
+}
+
+// backendFor returns the configured backend for a model, defaulting to Ollama.
+func (c Config) backendFor(model string) string {
+	if backend, ok := c.ModelBackends[model]; ok {
+		return backend
+	}
+	return BackendOllama
+}
+
+// embedder returns the cached Embedder for a model, creating it on first use.
+func (h *Handler) embedder(model string) (Embedder, error) {
+	h.embeddersMu.Lock()
+	defer h.embeddersMu.Unlock()
+
+	if e, ok := h.embedders[model]; ok {
+		return e, nil
+	}
+
+	var e Embedder
+	switch backend := h.config.backendFor(model); backend {
+	case BackendOllama:
+		e = NewOllamaEmbedder(h.config.OllamaURL, model, h.ollamaClient)
+	case BackendOpenAI:
+		e = NewOpenAIEmbedder(h.config.OpenAIURL, h.config.OpenAIAPIKey, model, h.openAIClient)
+	default:
+		return nil, fmt.Errorf("unknown embedding backend %q for model %s", backend, model)
+	}
+
+	h.embedders[model] = e
+	return e, nil
+}
@@ -0,0 +1,330 @@
+package document
+
+import (
+	"archive/zip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// EPUBExtractor extracts EPUB books. Chapters are read in the reading order
+// of the package's spine and converted like HTML pages. Each chapter is
+// titled from the book's table of contents, and its headings become sections
+// nested under that title. The package metadata provides the title,
+// authors, description and publication date.
+type EPUBExtractor struct{}
+
+func (EPUBExtractor) Name() string { return "epub" }
+
+// opfPackage is the package document of an EPUB, listing its metadata, its
+// files and their reading order.
+type opfPackage struct {
+	Metadata struct {
+		Titles      []string `xml:"http://purl.org/dc/elements/1.1/ title"`
+		Creators    []string `xml:"http://purl.org/dc/elements/1.1/ creator"`
+		Description string   `xml:"http://purl.org/dc/elements/1.1/ description"`
+		Subjects    []string `xml:"http://purl.org/dc/elements/1.1/ subject"`
+		Dates       []string `xml:"http://purl.org/dc/elements/1.1/ date"`
+	} `xml:"metadata"`
+	Manifest []struct {
+		ID         string `xml:"id,attr"`
+		Href       string `xml:"href,attr"`
+		MediaType  string `xml:"media-type,attr"`
+		Properties string `xml:"properties,attr"`
+	} `xml:"manifest>item"`
+	Spine struct {
+		Toc   string `xml:"toc,attr"`
+		Items []struct {
+			IDRef  string `xml:"idref,attr"`
+			Linear string `xml:"linear,attr"`
+		} `xml:"itemref"`
+	} `xml:"spine"`
+}
+
+func (EPUBExtractor) Extract(ctx context.Context, path, filename string, progress func(string)) (*Content, error) {
+	if progress != nil {
+		progress("Reading EPUB book...")
+	}
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read EPUB: %w", err)
+	}
+	defer zr.Close()
+
+	opfPath, err := readEPUBContainer(&zr.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read EPUB: %w", err)
+	}
+	var pkg opfPackage
+	if err := decodeZipXML(&zr.Reader, opfPath, &pkg); err != nil {
+		return nil, fmt.Errorf("failed to read EPUB package: %w", err)
+	}
+
+	// Manifest paths are relative to the package document
+	hrefs := make(map[string]string)
+	types := make(map[string]string)
+	for _, item := range pkg.Manifest {
+		hrefs[item.ID] = resolveHref(opfPath, item.Href)
+		types[item.ID] = item.MediaType
+	}
+	toc := readEPUBToc(&zr.Reader, &pkg, hrefs, filename)
+
+	var chapters []string
+	for _, ref := range pkg.Spine.Items {
+		// Non-linear items, such as footnotes, are not part of the reading order
+		if ref.Linear == "no" || (types[ref.IDRef] != "application/xhtml+xml" && types[ref.IDRef] != "text/html") {
+			continue
+		}
+		chapters = append(chapters, hrefs[ref.IDRef])
+	}
+	log.Printf("[EPUB READING] File: %s | Chapters: %d | TOC entries: %d", filename, len(chapters), len(toc))
+
+	content := &Content{KeepLineBreaks: true, Info: pkg.info()}
+	var (
+		buf     strings.Builder
+		chapter string
+	)
+	for i, name := range chapters {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if progress != nil {
+			progress(fmt.Sprintf("Read %d/%d chapters", i+1, len(chapters)))
+		}
+
+		part, err := openZipPart(&zr.Reader, name)
+		if err != nil {
+			log.Printf("[EPUB CHAPTER SKIP] File: %s | Chapter: %s | Error: %v", filename, name, err)
+			continue
+		}
+		data, err := io.ReadAll(part)
+		part.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read EPUB chapter %s: %w", name, err)
+		}
+		doc, err := parseHTML(data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read EPUB chapter %s: %w", name, err)
+		}
+		text, _ := renderHTML(mainContent(doc), true)
+		if strings.TrimSpace(text.Text) == "" {
+			continue
+		}
+
+		// Files missing from the table of contents continue the chapter
+		// before them, as books split long chapters into several files.
+		// Without a table of contents each file's first heading titles it.
+		title, ok := toc[name]
+		switch {
+		case ok:
+			chapter = title
+		case len(toc) == 0 && len(text.Sections) > 0:
+			chapter, _, _ = strings.Cut(text.Sections[0].Title, " > ")
+		case len(toc) == 0:
+			chapter = ""
+		}
+
+		if buf.Len() > 0 {
+			buf.WriteString("\n\n")
+		}
+		base := buf.Len()
+		buf.WriteString(text.Text)
+		if chapter != "" && (len(content.Chapters) == 0 || content.Chapters[len(content.Chapters)-1].Title != chapter) {
+			content.Chapters = append(content.Chapters, Section{Title: chapter, Offset: base})
+		}
+		if chapter != "" {
+			content.Sections = append(content.Sections, Section{Title: chapter, Offset: base})
+		}
+		for _, s := range text.Sections {
+			// The chapter's own heading usually repeats its title
+			if chapter != "" && s.Title != chapter && !strings.HasPrefix(s.Title, chapter+" > ") {
+				s.Title = chapter + " > " + s.Title
+			}
+			content.Sections = append(content.Sections, Section{Title: s.Title, Offset: base + s.Offset})
+		}
+		for _, v := range text.Verbatim {
+			content.Verbatim = append(content.Verbatim, Span{Start: base + v.Start, End: base + v.End})
+		}
+	}
+
+	content.Text = buf.String()
+	log.Printf("[EPUB READING COMPLETE] File: %s | Title: %q | Chapters: %d | Text length: %d chars",
+		filename, content.Info.Title, len(content.Chapters), buf.Len())
+	return content, nil
+}
+
+// info returns the book's title, authors, description (or else subjects) and
+// publication date.
+func (pkg *opfPackage) info() DocumentInfo {
+	var info DocumentInfo
+	m := pkg.Metadata
+	if len(m.Titles) > 0 {
+		info.Title = strings.TrimSpace(m.Titles[0])
+	}
+	var creators []string
+	for _, c := range m.Creators {
+		if c = strings.TrimSpace(c); c != "" {
+			creators = append(creators, c)
+		}
+	}
+	info.Author = strings.Join(creators, ", ")
+	info.Subject = collapseSpace(m.Description)
+	if info.Subject == "" {
+		info.Subject = strings.Join(m.Subjects, ", ")
+	}
+	if len(m.Dates) > 0 {
+		for _, layout := range []string{time.RFC3339, "2006-01-02", "2006-01", "2006"} {
+			if t, err := time.Parse(layout, strings.TrimSpace(m.Dates[0])); err == nil {
+				info.Created = t.Format(time.RFC3339)
+				break
+			}
+		}
+	}
+	return info
+}
+
+// readEPUBContainer returns the path of the package document named by
+// META-INF/container.xml.
+func readEPUBContainer(zr *zip.Reader) (string, error) {
+	var container struct {
+		Rootfiles []struct {
+			FullPath  string `xml:"full-path,attr"`
+			MediaType string `xml:"media-type,attr"`
+		} `xml:"rootfiles>rootfile"`
+	}
+	if err := decodeZipXML(zr, "META-INF/container.xml", &container); err != nil {
+		return "", err
+	}
+	for _, rf := range container.Rootfiles {
+		if rf.MediaType == "application/oebps-package+xml" || rf.MediaType == "" {
+			return rf.FullPath, nil
+		}
+	}
+	return "", errors.New("no package document in META-INF/container.xml")
+}
+
+// readEPUBToc maps the files of a book to the titles the table of contents
+// gives them: the EPUB 3 navigation document if there is one, else the
+// EPUB 2 NCX. A file linked from several entries takes the first title.
+// A missing or broken table of contents yields an empty map.
+func readEPUBToc(zr *zip.Reader, pkg *opfPackage, hrefs map[string]string, filename string) map[string]string {
+	toc := make(map[string]string)
+	add := func(base, href, title string) {
+		title = collapseSpace(title)
+		name := resolveHref(base, href)
+		if _, ok := toc[name]; title != "" && !ok {
+			toc[name] = title
+		}
+	}
+
+	for _, item := range pkg.Manifest {
+		if !hasToken(item.Properties, "nav") {
+			continue
+		}
+		name := hrefs[item.ID]
+		part, err := openZipPart(zr, name)
+		if err != nil {
+			break
+		}
+		data, err := io.ReadAll(part)
+		part.Close()
+		if err != nil {
+			log.Printf("[EPUB TOC ERROR] File: %s | Error: %v", filename, err)
+			break
+		}
+		doc, err := parseHTML(data)
+		if err != nil {
+			break
+		}
+		if nav := findTocNav(doc); nav != nil {
+			var visit func(n *html.Node)
+			visit = func(n *html.Node) {
+				if n.DataAtom == atom.A {
+					if href := getAttr(n, "href"); href != "" {
+						add(name, href, textContent(n))
+					}
+					return
+				}
+				for c := n.FirstChild; c != nil; c = c.NextSibling {
+					visit(c)
+				}
+			}
+			visit(nav)
+		}
+		if len(toc) > 0 {
+			return toc
+		}
+	}
+
+	if pkg.Spine.Toc == "" {
+		return toc
+	}
+	type navPoint struct {
+		Label   string `xml:"navLabel>text"`
+		Content struct {
+			Src string `xml:"src,attr"`
+		} `xml:"content"`
+		Points []navPoint `xml:"navPoint"`
+	}
+	var ncx struct {
+		Points []navPoint `xml:"navMap>navPoint"`
+	}
+	name := hrefs[pkg.Spine.Toc]
+	if err := decodeZipXML(zr, name, &ncx); err != nil {
+		log.Printf("[EPUB TOC ERROR] File: %s | Error: %v", filename, err)
+		return toc
+	}
+	var visit func(points []navPoint)
+	visit = func(points []navPoint) {
+		for _, p := range points {
+			add(name, p.Content.Src, p.Label)
+			visit(p.Points)
+		}
+	}
+	visit(ncx.Points)
+	return toc
+}
+
+// findTocNav returns the <nav epub:type="toc"> element of a navigation
+// document, or else its first <nav>.
+func findTocNav(doc *html.Node) *html.Node {
+	var first, toc *html.Node
+	var visit func(n *html.Node)
+	visit = func(n *html.Node) {
+		if n.DataAtom == atom.Nav {
+			if first == nil {
+				first = n
+			}
+			if toc == nil && hasToken(getAttr(n, "epub:type"), "toc") {
+				toc = n
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			visit(c)
+		}
+	}
+	visit(doc)
+	if toc != nil {
+		return toc
+	}
+	return first
+}
+
+// resolveHref resolves a link found in the archive file base to the name of
+// the file it points to, without any fragment.
+func resolveHref(base, href string) string {
+	href, _, _ = strings.Cut(href, "#")
+	if unescaped, err := url.PathUnescape(href); err == nil {
+		href = unescaped
+	}
+	return path.Join(path.Dir(base), href)
+}
@@ -0,0 +1,164 @@
+package document
+
+import (
+	"context"
+	"testing"
+)
+
+const epubContainer = `<?xml version="1.0"?>
+<container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container">
+  <rootfiles><rootfile full-path="OEBPS/content.opf" media-type="application/oebps-package+xml"/></rootfiles>
+</container>`
+
+// epubPackage is an OPF package document with the given manifest items and
+// spine item refs.
+func epubPackage(spineToc, manifest, spine string) string {
+	return `<?xml version="1.0"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="3.0">
+  <metadata xmlns:dc="http://purl.org/dc/elements/1.1/">
+    <dc:title>The Book</dc:title>
+    <dc:creator>Jane Doe</dc:creator>
+    <dc:creator>John Roe</dc:creator>
+    <dc:subject>Fiction</dc:subject>
+    <dc:date>2024-03</dc:date>
+  </metadata>
+  <manifest>` + manifest + `</manifest>
+  <spine toc="` + spineToc + `">` + spine + `</spine>
+</package>`
+}
+
+// epubChapter is an XHTML chapter file.
+func epubChapter(body string) string {
+	return `<?xml version="1.0"?><html xmlns="http://www.w3.org/1999/xhtml"><head><title>x</title></head><body>` + body + `</body></html>`
+}
+
+func TestEPUBExtractor(t *testing.T) {
+	chapterItems := `
+    <item id="c1" href="text/one.xhtml" media-type="application/xhtml+xml"/>
+    <item id="c2" href="text/two.xhtml" media-type="application/xhtml+xml"/>
+    <item id="c2b" href="text/two-b.xhtml" media-type="application/xhtml+xml"/>
+    <item id="notes" href="text/notes.xhtml" media-type="application/xhtml+xml"/>
+    <item id="css" href="style.css" media-type="text/css"/>`
+	// The spine, not the manifest, gives the reading order
+	spine := `<itemref idref="c2"/><itemref idref="css"/><itemref idref="notes" linear="no"/><itemref idref="c2b"/><itemref idref="c1"/>`
+	chapters := []zipFile{
+		{"OEBPS/text/one.xhtml", epubChapter(`<h1>One</h1><p>First.</p><h2>Scene</h2><p>Later.</p>`)},
+		{"OEBPS/text/two.xhtml", epubChapter(`<h1>Chapter Two</h1><p>Second.</p>`)},
+		{"OEBPS/text/two-b.xhtml", epubChapter(`<p>Second, continued.</p>`)},
+		{"OEBPS/text/notes.xhtml", epubChapter(`<p>A footnote.</p>`)},
+		{"OEBPS/style.css", `p {}`},
+	}
+	nav := epubChapter(`<nav epub:type="landmarks"><ol><li><a href="text/notes.xhtml">Notes</a></li></ol></nav>` +
+		`<nav epub:type="toc"><ol><li><a href="text/one.xhtml">Chapter  One</a></li>` +
+		`<li><a href="text/two.xhtml#start">Chapter Two</a><ol><li><a href="text/two.xhtml#b">Part B</a></li></ol></li></ol></nav>`)
+	ncx := `<?xml version="1.0"?>
+<ncx xmlns="http://www.daisy.org/z3986/2005/ncx/"><navMap>
+  <navPoint><navLabel><text>Opening</text></navLabel><content src="text/one.xhtml"/></navPoint>
+  <navPoint><navLabel><text>Second</text></navLabel><content src="text/two.xhtml"/>
+    <navPoint><navLabel><text>Nested</text></navLabel><content src="text/two-b.xhtml"/></navPoint>
+  </navPoint>
+</navMap></ncx>`
+
+	text := "Chapter Two\n\nSecond.\n\nSecond, continued.\n\nOne\n\nFirst.\n\nScene\n\nLater."
+	tests := []struct {
+		name     string
+		files    []zipFile
+		text     string
+		chapters []wantSection
+		sections []wantSection
+	}{
+		{
+			name: "navigation document",
+			files: []zipFile{
+				{"OEBPS/content.opf", epubPackage("", chapterItems+`<item id="nav" href="nav.xhtml" media-type="application/xhtml+xml" properties="nav"/>`, spine)},
+				{"OEBPS/nav.xhtml", nav},
+			},
+			text: text,
+			chapters: []wantSection{
+				{"Chapter Two", "Chapter Two"},
+				{"Chapter One", "One"},
+			},
+			sections: []wantSection{
+				{"Chapter Two", "Chapter Two"},
+				{"Chapter Two", "Chapter Two"},
+				{"Chapter Two", "Second, continued."},
+				{"Chapter One", "One"},
+				{"Chapter One > One", "One"},
+				{"Chapter One > One > Scene", "Scene"},
+			},
+		},
+		{
+			name: "ncx",
+			files: []zipFile{
+				{"OEBPS/content.opf", epubPackage("ncx", chapterItems+`<item id="ncx" href="toc.ncx" media-type="application/x-dtbncx+xml"/>`, spine)},
+				{"OEBPS/toc.ncx", ncx},
+			},
+			text: text,
+			chapters: []wantSection{
+				{"Second", "Chapter Two"},
+				{"Nested", "Second, continued."},
+				{"Opening", "One"},
+			},
+			sections: []wantSection{
+				{"Second", "Chapter Two"},
+				{"Second > Chapter Two", "Chapter Two"},
+				{"Nested", "Second, continued."},
+				{"Opening", "One"},
+				{"Opening > One", "One"},
+				{"Opening > One > Scene", "Scene"},
+			},
+		},
+		{
+			name: "no table of contents",
+			files: []zipFile{
+				{"OEBPS/content.opf", epubPackage("", chapterItems, spine)},
+			},
+			text: text,
+			chapters: []wantSection{
+				{"Chapter Two", "Chapter Two"},
+				{"One", "One"},
+			},
+			sections: []wantSection{
+				{"Chapter Two", "Chapter Two"},
+				{"Chapter Two", "Chapter Two"},
+				{"One", "One"},
+				{"One", "One"},
+				{"One > Scene", "Scene"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files := append([]zipFile{{"mimetype", "application/epub+zip"}, {"META-INF/container.xml", epubContainer}}, chapters...)
+			path := writeTemp(t, "book.epub", zipBytes(t, append(files, tt.files...)...))
+			content, err := EPUBExtractor{}.Extract(context.Background(), path, "book.epub", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if content.Text != tt.text {
+				t.Errorf("text = %q, want %q", content.Text, tt.text)
+			}
+			want := DocumentInfo{Title: "The Book", Author: "Jane Doe, John Roe", Subject: "Fiction", Created: "2024-03-01T00:00:00Z"}
+			if content.Info != want {
+				t.Errorf("info = %+v, want %+v", content.Info, want)
+			}
+			checkSections(t, content.Text, content.Chapters, tt.chapters)
+			checkSections(t, content.Text, content.Sections, tt.sections)
+		})
+	}
+}
+
+func TestResolveHref(t *testing.T) {
+	tests := []struct {
+		base, href, want string
+	}{
+		{"OEBPS/content.opf", "text/one.xhtml", "OEBPS/text/one.xhtml"},
+		{"OEBPS/nav/nav.xhtml", "../text/one.xhtml#start", "OEBPS/text/one.xhtml"},
+		{"content.opf", "chapter%201.xhtml", "chapter 1.xhtml"},
+	}
+	for _, tt := range tests {
+		if got := resolveHref(tt.base, tt.href); got != tt.want {
+			t.Errorf("resolveHref(%q, %q) = %q, want %q", tt.base, tt.href, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,237 @@
+package document
+
+import (
+	"archive/zip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// MIME types of the formats that can be uploaded.
+const (
+	MimePDF      = "application/pdf"
+	MimeText     = "text/plain"
+	MimeMarkdown = "text/markdown"
+	MimeHTML     = "text/html"
+	MimeDOCX     = "application/vnd.openxmlformats-officedocument.wordprocessingml.document"
+	MimeEPUB     = "application/epub+zip"
+)
+
+var errUnsupportedType = errors.New("unsupported file type")
+
+// Content is the text extracted from an uploaded file, ready for chunking.
+type Content struct {
+	Text     string
+	Pages    int           // pages in the file, 0 for formats without pages
+	Offsets  []PageOffset  // where each extracted page starts in Text, in page order
+	Skipped  []SkippedPage // pages whose text could not be extracted
+	Info     DocumentInfo
+	Sections []Section // where each section starts in Text, sorted by offset
+	Chapters []Section // where each chapter of a book starts in Text, sorted by offset
+	Verbatim []Span    // parts of Text, such as code blocks, whose whitespace must be kept; sorted
+	// KeepLineBreaks keeps line breaks and blank lines between words in
+	// chunk text instead of turning them into spaces, for formats whose
+	// extracted text separates paragraphs and table rows that way
+	KeepLineBreaks bool
+}
+
+// Span is the byte range [Start, End) of a text.
+type Span struct {
+	Start int
+	End   int
+}
+
+// Section marks where a titled part of a file, such as a chapter, a heading
+// or a bookmarked page, starts in the extracted text.
+type Section struct {
+	Title  string
+	Offset int
+}
+
+// headingPath tracks the headings enclosing the current position of a
+// document, for formats whose sections are nested headings.
+type headingPath struct {
+	levels []int
+	titles []string
+}
+
+// enter records a heading of the given level and returns the path of titles
+// leading to it, such as "Install > Linux > Proxy".
+func (p *headingPath) enter(level int, title string) string {
+	for len(p.levels) > 0 && p.levels[len(p.levels)-1] >= level {
+		p.levels = p.levels[:len(p.levels)-1]
+		p.titles = p.titles[:len(p.titles)-1]
+	}
+	p.levels = append(p.levels, level)
+	p.titles = append(p.titles, title)
+	return strings.Join(p.titles, " > ")
+}
+
+// sectionAt returns the title of the last section starting at or before
+// offset. sections must be sorted by offset.
+func sectionAt(sections []Section, offset int) string {
+	i := sort.Search(len(sections), func(i int) bool { return sections[i].Offset > offset })
+	if i == 0 {
+		return ""
+	}
+	return sections[i-1].Title
+}
+
+// Extractor turns an uploaded file of one format into text.
+type Extractor interface {
+	// Extract reads the file at path. progress may be nil. It stops with
+	// ctx.Err() once ctx is cancelled.
+	Extract(ctx context.Context, path, filename string, progress func(string)) (*Content, error)
+	// Name identifies the format, e.g. "pdf". It is stored as the "source"
+	// of every chunk.
+	Name() string
+}
+
+// ExtractorRegistry maps MIME types to the extractors that handle them.
+type ExtractorRegistry struct {
+	mu     sync.RWMutex
+	byType map[string]Extractor
+}
+
+func NewExtractorRegistry() *ExtractorRegistry {
+	return &ExtractorRegistry{byType: make(map[string]Extractor)}
+}
+
+// Register makes e handle files of mimeType, replacing any earlier extractor.
+func (x *ExtractorRegistry) Register(mimeType string, e Extractor) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.byType[mimeType] = e
+}
+
+// Lookup returns the extractor for mimeType. It fails with
+// errUnsupportedType if there is none.
+func (x *ExtractorRegistry) Lookup(mimeType string) (Extractor, error) {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	e, ok := x.byType[mimeType]
+	if !ok {
+		return nil, fmt.Errorf("%w %s (supported: %s)", errUnsupportedType, mimeType, strings.Join(x.typesLocked(), ", "))
+	}
+	return e, nil
+}
+
+// Types returns the supported MIME types, sorted.
+func (x *ExtractorRegistry) Types() []string {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	return x.typesLocked()
+}
+
+func (x *ExtractorRegistry) typesLocked() []string {
+	types := make([]string, 0, len(x.byType))
+	for t := range x.byType {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// newExtractorRegistry registers the built-in extractors.
+func newExtractorRegistry(cfg Config) *ExtractorRegistry {
+	x := NewExtractorRegistry()
+	x.Register(MimePDF, PDFExtractor{Options: cfg.PDF})
+	x.Register(MimeText, TextExtractor{})
+	x.Register(MimeMarkdown, MarkdownExtractor{})
+	x.Register(MimeHTML, HTMLExtractor{})
+	x.Register(MimeDOCX, DocxExtractor{})
+	x.Register(MimeEPUB, EPUBExtractor{})
+	return x
+}
+
+// sniffContentType determines the MIME type of an upload of the given size
+// from its content. Zip archives are told apart by the files they contain.
+// The filename is only consulted to tell apart formats whose content looks
+// the same, such as Markdown and plain text, never to override the content.
+func sniffContentType(r io.ReaderAt, size int64, filename string) (string, error) {
+	head := make([]byte, 512)
+	n, err := r.ReadAt(head, 0)
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	detected, _, err := mime.ParseMediaType(http.DetectContentType(head[:n]))
+	if err != nil {
+		return "application/octet-stream", nil
+	}
+
+	if detected == "application/zip" {
+		return sniffZip(r, size), nil
+	}
+
+	ext := strings.ToLower(filepath.Ext(filename))
+	// Markdown may start with inline HTML, which sniffs as text/html
+	if strings.HasPrefix(detected, "text/") && (ext == ".md" || ext == ".markdown") {
+		return MimeMarkdown, nil
+	}
+	// XHTML sniffs as XML, and a page starting with a comment as plain text
+	if strings.HasPrefix(detected, "text/") && (ext == ".html" || ext == ".htm" || ext == ".xhtml") {
+		return MimeHTML, nil
+	}
+	return detected, nil
+}
+
+// sniffZip determines the MIME type of a zip-based format from the files
+// in the archive.
+func sniffZip(r io.ReaderAt, size int64) string {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return "application/zip"
+	}
+	for _, f := range zr.File {
+		switch f.Name {
+		case "word/document.xml":
+			return MimeDOCX
+		case "META-INF/container.xml":
+			return MimeEPUB
+		}
+	}
+	return "application/zip"
+}
+
+// PDFExtractor extracts the text of PDF files with ReadPDF. Bookmarks
+// become sections starting at the page they point to.
+type PDFExtractor struct {
+	Options PDFOptions
+}
+
+func (PDFExtractor) Name() string { return "pdf" }
+
+func (e PDFExtractor) Extract(ctx context.Context, path, filename string, progress func(string)) (*Content, error) {
+	if progress != nil {
+		progress("Reading PDF file...")
+	}
+	pdfContent, err := ReadPDF(ctx, path, filename, e.Options, progress)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read PDF: %w", err)
+	}
+
+	content := &Content{
+		Text:    pdfContent.Text,
+		Pages:   pdfContent.Pages,
+		Offsets: pdfContent.Offsets,
+		Skipped: pdfContent.Skipped,
+		Info:    pdfContent.Info,
+	}
+	for _, entry := range pdfContent.Outline {
+		// A bookmark to a skipped page starts where the next extracted page does
+		i := sort.Search(len(pdfContent.Offsets), func(i int) bool { return pdfContent.Offsets[i].Page >= entry.Page })
+		offset := len(pdfContent.Text)
+		if i < len(pdfContent.Offsets) {
+			offset = pdfContent.Offsets[i].Offset
+		}
+		content.Sections = append(content.Sections, Section{Title: entry.Title, Offset: offset})
+	}
+	return content, nil
+}
@@ -0,0 +1,173 @@
+package document
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// zipFile is a file to put in a test archive.
+type zipFile struct {
+	name, body string
+}
+
+// zipBytes builds a zip archive holding files in the given order.
+func zipBytes(t *testing.T, files ...zipFile) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, f := range files {
+		w, err := zw.Create(f.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(f.body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// writeTemp writes data to a file called name in a temporary directory and
+// returns its path.
+func writeTemp(t *testing.T, name string, data []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// wantSection is a section expected in extracted text: its title and the
+// text it starts with.
+type wantSection struct {
+	title, starts string
+}
+
+// checkSections fails t unless sections are the wanted ones, in order.
+func checkSections(t *testing.T, text string, sections []Section, want []wantSection) {
+	t.Helper()
+	if len(sections) != len(want) {
+		t.Fatalf("sections = %q, want %d sections", sectionTitles(sections), len(want))
+	}
+	for i, w := range want {
+		s := sections[i]
+		if s.Title != w.title || !strings.HasPrefix(text[s.Offset:], w.starts) {
+			t.Errorf("section %d = %q starting %.30q, want %q starting %q", i, s.Title, text[s.Offset:], w.title, w.starts)
+		}
+	}
+}
+
+func sectionTitles(sections []Section) []string {
+	titles := make([]string, len(sections))
+	for i, s := range sections {
+		titles[i] = s.Title
+	}
+	return titles
+}
+
+// nopExtractor is an extractor that extracts nothing.
+type nopExtractor struct{ name string }
+
+func (e nopExtractor) Name() string { return e.name }
+
+func (nopExtractor) Extract(ctx context.Context, path, filename string, progress func(string)) (*Content, error) {
+	return &Content{}, nil
+}
+
+func TestExtractorRegistry(t *testing.T) {
+	x := NewExtractorRegistry()
+	x.Register("text/plain", nopExtractor{"old"})
+	x.Register("text/plain", nopExtractor{"text"})
+	x.Register(MimePDF, nopExtractor{"pdf"})
+
+	if got, want := x.Types(), []string{MimePDF, "text/plain"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Types() = %q, want %q", got, want)
+	}
+	e, err := x.Lookup("text/plain")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.Name() != "text" {
+		t.Errorf("Lookup returned %q, want the extractor registered last", e.Name())
+	}
+	if _, err := x.Lookup("image/png"); !errors.Is(err, errUnsupportedType) {
+		t.Errorf("Lookup(image/png) = %v, want errUnsupportedType", err)
+	}
+}
+
+func TestSniffContentType(t *testing.T) {
+	docx := zipBytes(t,
+		zipFile{"[Content_Types].xml", `<Types/>`},
+		zipFile{"word/document.xml", `<w:document/>`},
+	)
+	epub := zipBytes(t,
+		zipFile{"mimetype", "application/epub+zip"},
+		zipFile{"META-INF/container.xml", `<container/>`},
+	)
+	plainZip := zipBytes(t, zipFile{"notes.txt", "hello"})
+
+	tests := []struct {
+		name     string
+		filename string
+		data     []byte
+		want     string
+	}{
+		{"pdf", "report.pdf", []byte("%PDF-1.7\n1 0 obj"), MimePDF},
+		{"docx", "report.docx", docx, MimeDOCX},
+		{"epub", "book.epub", epub, MimeEPUB},
+		{"docx named like an epub", "book.epub", docx, MimeDOCX},
+		{"other zip", "archive.zip", plainZip, "application/zip"},
+		{"broken zip", "report.docx", []byte("PK\x03\x04\x14\x00\x00\x00"), "application/zip"},
+		{"plain text", "notes.txt", []byte("Just some notes.\n"), MimeText},
+		{"markdown", "README.md", []byte("# Title\n\nSome text.\n"), MimeMarkdown},
+		{"markdown with inline html", "README.markdown", []byte("<p align=\"center\">logo</p>\n\n# Title\n"), MimeMarkdown},
+		{"markdown extension is case-insensitive", "NOTES.MD", []byte("Some text.\n"), MimeMarkdown},
+		{"html", "page.html", []byte("<!DOCTYPE html><html><body>Hi</body></html>"), MimeHTML},
+		{"html starting with a comment", "page.htm", []byte("<!-- saved from url -->\n<html><body>Hi</body></html>"), MimeHTML},
+		{"xhtml", "page.xhtml", []byte(`<?xml version="1.0"?><html xmlns="http://www.w3.org/1999/xhtml"></html>`), MimeHTML},
+		{"html without an extension", "page", []byte("<!DOCTYPE html><html><body>Hi</body></html>"), MimeHTML},
+		{"binary", "data.md", []byte{0x00, 0x01, 0x02, 0xff}, "application/octet-stream"},
+		{"extension does not override content", "report.md", []byte("%PDF-1.7\n1 0 obj"), MimePDF},
+		{"html content named .txt", "notes.txt", []byte("<p>not a page</p>"), MimeHTML},
+		{"empty", "empty.md", nil, MimeMarkdown},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := sniffContentType(bytes.NewReader(tt.data), int64(len(tt.data)), tt.filename)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("sniffContentType(%q) = %s, want %s", tt.filename, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHeadingPath(t *testing.T) {
+	var p headingPath
+	var got []string
+	for _, h := range []struct {
+		level int
+		title string
+	}{
+		{1, "Install"}, {2, "Linux"}, {3, "Proxy"}, {2, "macOS"}, {4, "Deep"}, {1, "Usage"},
+	} {
+		got = append(got, p.enter(h.level, h.title))
+	}
+	want := []string{"Install", "Install > Linux", "Install > Linux > Proxy", "Install > macOS", "Install > macOS > Deep", "Usage"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("paths = %q, want %q", got, want)
+	}
+}
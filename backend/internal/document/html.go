@@ -0,0 +1,427 @@
+package document
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+	"golang.org/x/net/html/charset"
+)
+
+// boilerplateClass matches class and id names of page furniture, such as
+// "site-nav" or "cookie_banner".
+var boilerplateClass = regexp.MustCompile(`(?i)(^|[-_ ])(nav|navbar|menu|sidebar|breadcrumbs?|footer|cookies?|banner|ads?|advert|share|social|comments|related|subscribe|newsletter|popup|modal)([-_ ]|$)`)
+
+// HTMLExtractor extracts saved web pages. Scripts, styles, forms and page
+// furniture such as navigation, headers, footers and sidebars are dropped;
+// if the page marks its main content with <main> or a single <article>, only
+// that is kept. Headings start sections titled with their heading path, list
+// items and table rows become lines and <pre> blocks are kept verbatim. The
+// <title>, canonical URL, author, description and publication date are read
+// from the head.
+type HTMLExtractor struct{}
+
+func (HTMLExtractor) Name() string { return "html" }
+
+func (HTMLExtractor) Extract(ctx context.Context, path, filename string, progress func(string)) (*Content, error) {
+	if progress != nil {
+		progress("Reading HTML page...")
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := parseHTML(data)
+	if err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	info := readHTMLInfo(doc)
+	root := mainContent(doc)
+	content, firstH1 := renderHTML(root, root.DataAtom == atom.Main || root.DataAtom == atom.Article)
+	if info.Title == "" {
+		info.Title = firstH1
+	}
+	content.Info = info
+	return content, nil
+}
+
+// parseHTML parses a page that is not necessarily UTF-8; the encoding comes
+// from a byte order mark or <meta charset>, as saved pages often use others.
+func parseHTML(data []byte) (*html.Node, error) {
+	enc, _, _ := charset.DetermineEncoding(data, "text/html")
+	if decoded, err := enc.NewDecoder().Bytes(data); err == nil {
+		data = decoded
+	}
+	doc, err := html.Parse(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse HTML: %w", err)
+	}
+	return doc, nil
+}
+
+// renderHTML turns the content below root into text and returns it with the
+// first top-level heading. inArticle keeps <header> and <footer> elements,
+// which are page furniture only outside an article.
+func renderHTML(root *html.Node, inArticle bool) (*Content, string) {
+	r := &htmlRenderer{content: &Content{KeepLineBreaks: true}, inArticle: inArticle}
+	r.walk(root)
+	r.flush()
+	r.content.Text = r.buf.String()
+	return r.content, r.firstH1
+}
+
+// readHTMLInfo reads the title and the <link> and <meta> tags of a page.
+// The Open Graph and article tags fill in what the standard ones leave out.
+func readHTMLInfo(doc *html.Node) DocumentInfo {
+	var info DocumentInfo
+	meta := make(map[string]string)
+	var visit func(n *html.Node)
+	visit = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			switch n.DataAtom {
+			case atom.Title:
+				if info.Title == "" {
+					info.Title = collapseSpace(textContent(n))
+				}
+			case atom.Link:
+				if hasToken(getAttr(n, "rel"), "canonical") && info.URL == "" {
+					info.URL = strings.TrimSpace(getAttr(n, "href"))
+				}
+			case atom.Meta:
+				key := strings.ToLower(getAttr(n, "name"))
+				if key == "" {
+					key = strings.ToLower(getAttr(n, "property"))
+				}
+				if _, ok := meta[key]; key != "" && !ok {
+					meta[key] = strings.TrimSpace(getAttr(n, "content"))
+				}
+			case atom.Body:
+				return
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			visit(c)
+		}
+	}
+	visit(doc)
+
+	first := func(keys ...string) string {
+		for _, key := range keys {
+			if v := meta[key]; v != "" {
+				return v
+			}
+		}
+		return ""
+	}
+	if info.Title == "" {
+		info.Title = first("og:title")
+	}
+	if info.URL == "" {
+		info.URL = first("og:url")
+	}
+	info.Author = first("author", "article:author")
+	info.Subject = first("description", "og:description")
+	date := first("article:published_time", "date", "dc.date", "dcterms.created")
+	for _, layout := range []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02"} {
+		if t, err := time.Parse(layout, date); err == nil {
+			info.Created = t.Format(time.RFC3339)
+			break
+		}
+	}
+	return info
+}
+
+// mainContent returns the element holding the main content of a page: its
+// <main>, else its only <article>, else its <body>.
+func mainContent(doc *html.Node) *html.Node {
+	var body, main *html.Node
+	var articles []*html.Node
+	var visit func(n *html.Node)
+	visit = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			switch {
+			case n.DataAtom == atom.Body && body == nil:
+				body = n
+			case (n.DataAtom == atom.Main || getAttr(n, "role") == "main") && main == nil:
+				main = n
+			case n.DataAtom == atom.Article:
+				articles = append(articles, n)
+			}
+			if skipHTML(n, false) {
+				return
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			visit(c)
+		}
+	}
+	visit(doc)
+
+	switch {
+	case main != nil:
+		return main
+	case len(articles) == 1:
+		return articles[0]
+	case body != nil:
+		return body
+	}
+	return doc
+}
+
+// skipHTML reports whether an element is not part of a page's content.
+// Headers and footers belong to the content inside an article, where they
+// hold its title and notes rather than the site's.
+func skipHTML(n *html.Node, inArticle bool) bool {
+	switch n.DataAtom {
+	case atom.Head, atom.Script, atom.Style, atom.Noscript, atom.Template, atom.Iframe,
+		atom.Svg, atom.Math, atom.Canvas, atom.Form, atom.Button, atom.Input, atom.Select,
+		atom.Textarea, atom.Nav, atom.Aside, atom.Dialog:
+		return true
+	case atom.Header, atom.Footer:
+		if !inArticle {
+			return true
+		}
+	}
+	if _, hidden := findAttr(n, "hidden"); hidden || getAttr(n, "aria-hidden") == "true" {
+		return true
+	}
+	switch getAttr(n, "role") {
+	case "navigation", "banner", "contentinfo", "complementary", "search", "dialog":
+		return true
+	}
+	// Class names are only trusted on containers; inline elements use them
+	// for things like syntax highlighting
+	switch n.DataAtom {
+	case atom.Div, atom.Section, atom.Ul, atom.Ol:
+		return boilerplateClass.MatchString(getAttr(n, "class")) || boilerplateClass.MatchString(getAttr(n, "id"))
+	}
+	return false
+}
+
+// htmlRenderer turns the content of a page into text: blocks separated by
+// blank lines, list items and table rows on lines of their own.
+type htmlRenderer struct {
+	content   *Content
+	buf       strings.Builder
+	path      headingPath
+	firstH1   string
+	inArticle bool
+
+	lines  []string // text of the current block, split at <br>
+	prefix string   // list marker for the current block
+	lists  int      // depth of open lists
+	inList bool     // whether the last block written was inside a list
+}
+
+func (r *htmlRenderer) walk(n *html.Node) {
+	switch n.Type {
+	case html.TextNode:
+		if len(r.lines) == 0 {
+			r.lines = []string{""}
+		}
+		r.lines[len(r.lines)-1] += n.Data
+		return
+	case html.ElementNode, html.DocumentNode:
+	default:
+		return
+	}
+	if n.Type == html.ElementNode && skipHTML(n, r.inArticle) {
+		return
+	}
+
+	switch n.DataAtom {
+	case atom.Br:
+		r.lines = append(r.lines, "")
+	case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6:
+		r.flush()
+		title := collapseSpace(textContent(n))
+		if title == "" {
+			return
+		}
+		level := int(n.Data[1] - '0')
+		if level == 1 && r.firstH1 == "" {
+			r.firstH1 = title
+		}
+		offset := r.write(title)
+		r.content.Sections = append(r.content.Sections, Section{Title: r.path.enter(level, title), Offset: offset})
+	case atom.Ul, atom.Ol:
+		r.flush()
+		r.lists++
+		number := 1
+		if start, err := strconv.Atoi(getAttr(n, "start")); err == nil {
+			number = start
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			if c.DataAtom != atom.Li {
+				r.walk(c)
+				continue
+			}
+			if skipHTML(c, r.inArticle) {
+				continue
+			}
+			r.flush()
+			r.prefix = strings.Repeat("  ", r.lists-1) + "- "
+			if n.DataAtom == atom.Ol {
+				r.prefix = strings.Repeat("  ", r.lists-1) + strconv.Itoa(number) + ". "
+				number++
+			}
+			r.walkChildren(c)
+			r.flush()
+		}
+		r.lists--
+		r.flush()
+	case atom.Table:
+		r.flush()
+		var rows []string
+		r.tableRows(n, &rows)
+		r.write(strings.Join(rows, "\n"))
+	case atom.Pre:
+		r.flush()
+		text := strings.Trim(textContent(n), "\n")
+		if strings.TrimSpace(text) == "" {
+			return
+		}
+		start := r.write(text)
+		r.content.Verbatim = append(r.content.Verbatim, Span{Start: start, End: start + len(text)})
+	case atom.P, atom.Div, atom.Section, atom.Article, atom.Main, atom.Header, atom.Footer, atom.Blockquote,
+		atom.Figure, atom.Figcaption, atom.Address, atom.Dl, atom.Dt, atom.Dd, atom.Details, atom.Summary,
+		atom.Hr, atom.Li, atom.Body:
+		r.flush()
+		inArticle := r.inArticle
+		r.inArticle = inArticle || n.DataAtom == atom.Article
+		r.walkChildren(n)
+		r.inArticle = inArticle
+		r.flush()
+	default:
+		r.walkChildren(n)
+	}
+}
+
+func (r *htmlRenderer) walkChildren(n *html.Node) {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		r.walk(c)
+	}
+}
+
+// tableRows collects the rows of a table, with the text of each cell joined
+// by " | ". Nested tables are flattened into their cell.
+func (r *htmlRenderer) tableRows(n *html.Node, rows *[]string) {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type != html.ElementNode || skipHTML(c, r.inArticle) {
+			continue
+		}
+		if c.DataAtom != atom.Tr {
+			r.tableRows(c, rows)
+			continue
+		}
+		var cells []string
+		for cell := c.FirstChild; cell != nil; cell = cell.NextSibling {
+			if cell.DataAtom == atom.Td || cell.DataAtom == atom.Th {
+				cells = append(cells, collapseSpace(textContent(cell)))
+			}
+		}
+		if row := strings.Join(cells, " | "); strings.Trim(row, " |") != "" {
+			*rows = append(*rows, row)
+		}
+	}
+}
+
+// flush writes the pending inline text as a block.
+func (r *htmlRenderer) flush() {
+	var lines []string
+	for _, line := range r.lines {
+		if line = collapseSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	r.lines = nil
+	if len(lines) > 0 {
+		r.write(r.prefix + strings.Join(lines, "\n"))
+	}
+	r.prefix = ""
+}
+
+// write appends a block and returns the offset it starts at. Blocks inside
+// a list follow each other on consecutive lines.
+func (r *htmlRenderer) write(block string) int {
+	if block == "" {
+		return r.buf.Len()
+	}
+	switch {
+	case r.buf.Len() == 0:
+	case r.lists > 0 && r.inList:
+		r.buf.WriteString("\n")
+	default:
+		r.buf.WriteString("\n\n")
+	}
+	r.inList = r.lists > 0
+	offset := r.buf.Len()
+	r.buf.WriteString(block)
+	return offset
+}
+
+// textContent returns the text inside n, leaving out elements that are not
+// content.
+func textContent(n *html.Node) string {
+	var b strings.Builder
+	var visit func(n *html.Node)
+	visit = func(n *html.Node) {
+		switch n.Type {
+		case html.TextNode:
+			b.WriteString(n.Data)
+			return
+		case html.ElementNode:
+			switch n.DataAtom {
+			case atom.Script, atom.Style, atom.Noscript, atom.Template:
+				return
+			case atom.Br:
+				b.WriteByte('\n')
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			visit(c)
+		}
+	}
+	visit(n)
+	return b.String()
+}
+
+func collapseSpace(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+func findAttr(n *html.Node, key string) (string, bool) {
+	for _, a := range n.Attr {
+		if a.Namespace == "" && a.Key == key {
+			return a.Val, true
+		}
+	}
+	return "", false
+}
+
+func getAttr(n *html.Node, key string) string {
+	v, _ := findAttr(n, key)
+	return v
+}
+
+// hasToken reports whether the space-separated list s contains token,
+// ignoring case.
+func hasToken(s, token string) bool {
+	for _, t := range strings.Fields(s) {
+		if strings.EqualFold(t, token) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,168 @@
+package document
+
+import (
+	"context"
+	"testing"
+)
+
+func TestHTMLExtractorContent(t *testing.T) {
+	tests := []struct {
+		name     string
+		page     string
+		text     string
+		sections []wantSection
+		verbatim []string
+	}{
+		{
+			name: "page furniture is dropped",
+			page: `<html><head><title>T</title><style>p{}</style></head><body>
+<header><a href="/">Site</a></header>
+<nav><a href="/a">A</a></nav>
+<div class="cookie-banner">We use cookies</div>
+<div id="sidebar">Links</div>
+<p>Body text.<script>track()</script></p>
+<div role="navigation">Crumbs</div>
+<p hidden>Hidden</p>
+<span class="share">kept inline</span>
+<form><input value="q"><button>Go</button></form>
+<footer>Copyright</footer>
+</body></html>`,
+			text: "Body text.\n\nkept inline",
+		},
+		{
+			name: "main wins over the rest of the body",
+			page: `<body><p>Teaser</p><main><h1>Story</h1><p>Text.</p></main><p>More</p></body>`,
+			text: "Story\n\nText.",
+			sections: []wantSection{
+				{"Story", "Story"},
+			},
+		},
+		{
+			name: "a single article wins and keeps its header and footer",
+			page: `<body><header>Site</header><article><header><h1>Post</h1></header><p>Text.</p><footer>Filed under news</footer></article><aside>Ads</aside></body>`,
+			text: "Post\n\nText.\n\nFiled under news",
+			sections: []wantSection{
+				{"Post", "Post"},
+			},
+		},
+		{
+			name: "several articles keep the body",
+			page: `<body><article><h2>One</h2></article><article><h2>Two</h2></article><footer>Site</footer></body>`,
+			text: "One\n\nTwo",
+			sections: []wantSection{
+				{"One", "One"},
+				{"Two", "Two"},
+			},
+		},
+		{
+			name: "heading paths",
+			page: `<body><h1>Install</h1><p>Intro.</p><h2>Linux</h2><h3>Proxy</h3><h2>macOS</h2><h1>Usage</h1></body>`,
+			text: "Install\n\nIntro.\n\nLinux\n\nProxy\n\nmacOS\n\nUsage",
+			sections: []wantSection{
+				{"Install", "Install"},
+				{"Install > Linux", "Linux"},
+				{"Install > Linux > Proxy", "Proxy"},
+				{"Install > macOS", "macOS"},
+				{"Usage", "Usage"},
+			},
+		},
+		{
+			name: "lists, tables and line breaks",
+			page: `<body><ul><li>One</li><li>Two<ol start="3"><li>Three</li></ol></li></ul>` +
+				`<table><tr><th>Item</th><th>Price</th></tr><tr><td>Tea</td><td>2</td></tr></table>` +
+				`<p>Line one<br>line   two</p></body>`,
+			text: "- One\n- Two\n  3. Three\n\nItem | Price\nTea | 2\n\nLine one\nline two",
+		},
+		{
+			name:     "pre is kept verbatim",
+			page:     "<body><p>Run:</p><pre>\nmake  build\n  ./app\n</pre></body>",
+			text:     "Run:\n\nmake  build\n  ./app",
+			verbatim: []string{"make  build\n  ./app"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeTemp(t, "page.html", []byte(tt.page))
+			content, err := HTMLExtractor{}.Extract(context.Background(), path, "page.html", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if content.Text != tt.text {
+				t.Errorf("text = %q, want %q", content.Text, tt.text)
+			}
+			checkSections(t, content.Text, content.Sections, tt.sections)
+			if len(content.Verbatim) != len(tt.verbatim) {
+				t.Fatalf("%d verbatim spans, want %d", len(content.Verbatim), len(tt.verbatim))
+			}
+			for i, v := range content.Verbatim {
+				if got := content.Text[v.Start:v.End]; got != tt.verbatim[i] {
+					t.Errorf("verbatim span %d = %q, want %q", i, got, tt.verbatim[i])
+				}
+			}
+		})
+	}
+}
+
+func TestHTMLExtractorInfo(t *testing.T) {
+	tests := []struct {
+		name string
+		page string
+		want DocumentInfo
+	}{
+		{
+			name: "standard tags",
+			page: `<html><head>
+<title> Release
+  notes </title>
+<link rel="stylesheet" href="/s.css">
+<link rel="Canonical" href=" https://example.com/notes ">
+<meta name="author" content="Jane Doe">
+<meta name="description" content="What changed">
+<meta property="article:published_time" content="2024-03-01T10:00:00Z">
+<meta property="og:url" content="https://example.com/og">
+</head><body><h1>Heading</h1></body></html>`,
+			want: DocumentInfo{Title: "Release notes", URL: "https://example.com/notes", Author: "Jane Doe", Subject: "What changed", Created: "2024-03-01T10:00:00Z"},
+		},
+		{
+			name: "open graph fills in",
+			page: `<head><meta property="og:title" content="OG title"><meta property="og:url" content="https://example.com/og">` +
+				`<meta property="og:description" content="OG description"><meta name="date" content="2024-03-01"></head><body><h1>Heading</h1></body>`,
+			want: DocumentInfo{Title: "OG title", URL: "https://example.com/og", Subject: "OG description", Created: "2024-03-01T00:00:00Z"},
+		},
+		{
+			name: "first heading is the last resort for the title",
+			page: `<body><h2>Sub</h2><h1>Heading</h1><h1>Other</h1></body>`,
+			want: DocumentInfo{Title: "Heading"},
+		},
+		{
+			name: "links in the body are not canonical",
+			page: `<head></head><body><link rel="canonical" href="https://example.com/body"><p>Text</p></body>`,
+			want: DocumentInfo{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeTemp(t, "page.html", []byte(tt.page))
+			content, err := HTMLExtractor{}.Extract(context.Background(), path, "page.html", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if content.Info != tt.want {
+				t.Errorf("info = %+v, want %+v", content.Info, tt.want)
+			}
+		})
+	}
+}
+
+func TestHTMLExtractorCharset(t *testing.T) {
+	// "Café" in ISO-8859-1
+	page := append([]byte(`<html><head><meta charset="iso-8859-1"></head><body><p>Caf`), 0xe9, '<', '/', 'p', '>')
+	path := writeTemp(t, "page.html", page)
+	content, err := HTMLExtractor{}.Extract(context.Background(), path, "page.html", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if content.Text != "Café" {
+		t.Errorf("text = %q, want %q", content.Text, "Café")
+	}
+}
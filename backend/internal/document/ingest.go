@@ -0,0 +1,274 @@
+package document
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/akhilmk/gowise/internal/resilient"
+	"github.com/google/uuid"
+)
+
+// maxReportedFailures bounds how many chunk failures an IngestResult lists;
+// ChunksFailed still counts all of them.
+const maxReportedFailures = 50
+
+// IngestResult summarises what an ingestion job did with its file. Chunk
+// counts cover the whole job, including work done before a restart.
+// DuplicateOf and DuplicateID are set when the upload was skipped because
+// the same content is already stored as the document with that filename and
+// ID.
+type IngestResult struct {
+	DuplicateOf    string         `json:"duplicate_of,omitempty"`
+	DuplicateID    string         `json:"duplicate_id,omitempty"`
+	PagesTotal     int            `json:"pages_total"`
+	PagesSkipped   []SkippedPage  `json:"pages_skipped,omitempty"`
+	ChunksCreated  int            `json:"chunks_created"`
+	ChunksEmbedded int            `json:"chunks_embedded"`
+	ChunksStored   int            `json:"chunks_stored"`
+	ChunksFailed   int            `json:"chunks_failed"`
+	Failures       []ChunkFailure `json:"failures,omitempty"`
+}
+
+// SkippedPage is a page whose text could not be extracted.
+type SkippedPage struct {
+	Page   int    `json:"page"`
+	Reason string `json:"reason"`
+}
+
+// ChunkFailure is a chunk that was not stored, and why.
+type ChunkFailure struct {
+	Chunk  int    `json:"chunk"` // 1-based chunk number
+	Stage  string `json:"stage"` // "embed" or "store"
+	Reason string `json:"reason"`
+}
+
+// addFailures counts failures and keeps the first maxReportedFailures.
+func (r *IngestResult) addFailures(failures []ChunkFailure) {
+	r.ChunksFailed += len(failures)
+	if room := maxReportedFailures - len(r.Failures); room > 0 {
+		r.Failures = append(r.Failures, failures[:min(room, len(failures))]...)
+	}
+}
+
+// batchResult reports the outcome of ingesting one batch of chunks.
+type batchResult struct {
+	index    int // batch number, used to restore order
+	start    int // zero-based index of the first chunk in the batch
+	end      int // exclusive
+	embedded int
+	stored   int
+	failures []ChunkFailure
+}
+
+// ingestChunks embeds and stores chunks[from:] using a bounded pool of
+// workers, one batch of EmbedBatchSize chunks at a time per worker. Progress,
+// result and the job checkpoint are advanced from the calling goroutine in
+// batch order, whatever order workers finish in. When ctx is cancelled no
+// further batches are started.
+func (h *Handler) ingestChunks(ctx context.Context, e Embedder, job *Job, meta map[string]interface{}, chunks []TextChunk, from int, result *IngestResult, progress func(string)) {
+	filename := job.Filename
+	batchSize := h.config.EmbedBatchSize
+	numBatches := (len(chunks) - from + batchSize - 1) / batchSize
+	workers := min(h.config.IngestWorkers, numBatches)
+	uploadedAt := job.CreatedAt.Format(time.RFC3339)
+
+	log.Printf("[INGEST START] File: %s | Chunks: %d | From: %d | Batches: %d | Workers: %d",
+		filename, len(chunks), from, numBatches, workers)
+
+	batches := make(chan int)
+	results := make(chan batchResult)
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for b := range batches {
+				start := from + b*batchSize
+				end := min(start+batchSize, len(chunks))
+				res := h.ingestBatch(ctx, e, job, meta, chunks[start:end], start, len(chunks), uploadedAt)
+				res.index = b
+				results <- res
+			}
+		}()
+	}
+
+	go func() {
+		defer close(batches)
+		for b := 0; b < numBatches; b++ {
+			select {
+			case batches <- b:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	// Buffer out-of-order results so progress is streamed in chunk order
+	pending := make(map[int]batchResult)
+	next := 0
+	for res := range results {
+		pending[res.index] = res
+		for {
+			r, ok := pending[next]
+			if !ok {
+				break
+			}
+			delete(pending, next)
+			next++
+			if ctx.Err() != nil {
+				continue // the job is rolled back, its counts no longer matter
+			}
+			result.ChunksEmbedded += r.embedded
+			result.ChunksStored += r.stored
+			result.addFailures(r.failures)
+			h.jobs.Checkpoint(job, r.end, *result)
+			if progress != nil {
+				progress(fmt.Sprintf("Processed chunks %d-%d/%d", r.start+1, r.end, len(chunks)))
+			}
+		}
+	}
+}
+
+// ingestBatch embeds and stores one batch of chunks. offset is the
+// zero-based index of the batch's first chunk.
+func (h *Handler) ingestBatch(ctx context.Context, e Embedder, job *Job, meta map[string]interface{}, batch []TextChunk, offset, total int, uploadedAt string) batchResult {
+	filename := job.Filename
+	res := batchResult{start: offset, end: offset + len(batch)}
+	if ctx.Err() != nil {
+		return res
+	}
+	log.Printf("[BATCH PROCESSING] File: %s | Chunks: %d-%d/%d",
+		filename, offset+1, offset+len(batch), total)
+
+	texts := make([]string, len(batch))
+	for i, chunk := range batch {
+		texts[i] = chunk.Text
+	}
+	embeddings, errs := h.embedBatch(ctx, e, filename, texts, offset, total)
+
+	records := make([]Chunk, 0, len(batch))
+	for i, chunk := range batch {
+		if errs[i] != nil {
+			res.failures = append(res.failures, ChunkFailure{Chunk: offset + i + 1, Stage: "embed", Reason: errs[i].Error()})
+			continue
+		}
+		records = append(records, newChunk(chunk, embeddings[i], job, meta, offset+i+1, uploadedAt))
+	}
+	res.embedded = len(records)
+	if len(records) == 0 {
+		return res
+	}
+
+	if err := h.store.Upsert(ctx, records); err != nil {
+		log.Printf("[BATCH WARNING] File: %s | Chunks: %d-%d/%d | Storage failed for %d chunks: %v",
+			filename, offset+1, offset+len(batch), total, len(records), err)
+		for i := range batch {
+			if errs[i] == nil {
+				res.failures = append(res.failures, ChunkFailure{Chunk: offset + i + 1, Stage: "store", Reason: err.Error()})
+			}
+		}
+		return res
+	}
+
+	log.Printf("[BATCH SUCCESS] File: %s | Stored %d chunks: %d-%d/%d",
+		filename, len(records), offset+1, offset+len(batch), total)
+	res.stored = len(records)
+	return res
+}
+
+// embedBatch embeds a batch of chunks in one request. If the batch fails it
+// falls back to embedding each chunk on its own so a single bad chunk does not
+// sink its neighbours. Failed chunks are logged and get their error at the
+// same index of the second return value.
+func (h *Handler) embedBatch(ctx context.Context, e Embedder, filename string, batch []string, offset, total int) ([][]float32, []error) {
+	errs := make([]error, len(batch))
+	embeddings, err := e.Embed(ctx, batch)
+	if err == nil {
+		return embeddings, errs
+	}
+	if ctx.Err() != nil || errors.Is(err, resilient.ErrCircuitOpen) {
+		// Retrying chunk by chunk would only be rejected again
+		if ctx.Err() == nil {
+			log.Printf("[BATCH WARNING] File: %s | Chunks: %d-%d/%d | Embedding skipped: %v",
+				filename, offset+1, offset+len(batch), total, err)
+		}
+		for i := range errs {
+			errs[i] = err
+		}
+		return make([][]float32, len(batch)), errs
+	}
+
+	log.Printf("[BATCH WARNING] File: %s | Chunks: %d-%d/%d | Batch embedding failed, retrying individually: %v",
+		filename, offset+1, offset+len(batch), total, err)
+
+	embeddings = make([][]float32, len(batch))
+	for i, chunk := range batch {
+		single, err := e.Embed(ctx, []string{chunk})
+		if err != nil {
+			log.Printf("[CHUNK WARNING] File: %s | Chunk: %d/%d | Embedding failed: %v",
+				filename, offset+i+1, total, err)
+			errs[i] = err
+			continue
+		}
+		embeddings[i] = single[0]
+	}
+	return embeddings, errs
+}
+
+// newChunk builds the stored record for one chunk of an uploaded file. The
+// job ID is kept so a cancelled job's chunks can be rolled back. Chunks stay
+// hidden from search (latest=false) until the job publishes its version.
+// meta holds the fields shared by every chunk of the file. page_start,
+// page_end and section are only set when known.
+func newChunk(text TextChunk, embedding []float32, job *Job, meta map[string]interface{}, chunkNum int, uploadedAt string) Chunk {
+	chunk := Chunk{
+		ID:        chunkID(job, chunkNum),
+		Text:      text.Text,
+		Embedding: embedding,
+		Metadata: map[string]interface{}{
+			"filename":     job.Filename,
+			"content_hash": job.ContentHash,
+			"job_id":       job.ID,
+			"document_id":  job.DocumentID,
+			"version":      job.Version,
+			"latest":       false,
+			"chunk_num":    chunkNum,
+			"uploaded_at":  uploadedAt,
+		},
+	}
+	if text.PageStart > 0 {
+		chunk.Metadata["page_start"] = text.PageStart
+		chunk.Metadata["page_end"] = text.PageEnd
+	}
+	if text.Section != "" {
+		chunk.Metadata["section"] = text.Section
+	}
+	if text.Chapter != "" {
+		chunk.Metadata["chapter"] = text.Chapter
+	}
+	for key, value := range meta {
+		chunk.Metadata[key] = value
+	}
+	return chunk
+}
+
+// chunkID derives a chunk's ID from the file's content hash and the chunk
+// number, so resuming a job after a restart overwrites its chunks instead of
+// duplicating them. File, version and chunking parameters are part of the
+// key because the same chunk number holds different text under other
+// parameters, and the same content stored as another file or version must
+// not overwrite it.
+func chunkID(job *Job, chunkNum int) string {
+	key := fmt.Sprintf("%s/%s/%d/%d/%d/%d", job.ContentHash, job.FileID, job.Version, job.ChunkSize, job.ChunkStride, chunkNum)
+	return uuid.NewSHA1(uuid.NameSpaceOID, []byte(key)).String()
+}
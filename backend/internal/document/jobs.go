@@ -0,0 +1,584 @@
+package document
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// JobStatus is the lifecycle state of an ingestion job.
+type JobStatus string
+
+const (
+	JobQueued    JobStatus = "queued"
+	JobRunning   JobStatus = "running"
+	JobCompleted JobStatus = "completed"
+	JobFailed    JobStatus = "failed"
+	JobCancelled JobStatus = "cancelled"
+)
+
+var (
+	errJobNotFound   = errors.New("job not found")
+	errJobFinished   = errors.New("job already finished")
+	errJobPublishing = errors.New("job is publishing its version and can no longer be cancelled")
+)
+
+// maxFinishedJobs bounds how many completed or failed jobs are kept in memory.
+const maxFinishedJobs = 200
+
+// Job is one queued upload. Its NDJSON progress messages are kept so clients
+// can (re)attach to the stream at any point. Checkpoint counts the leading
+// chunks that have been processed, so a restarted job skips them; Result
+// holds the counts so far and the final outcome once the job has ended.
+type Job struct {
+	ID             string        `json:"id"`
+	Filename       string        `json:"filename"`
+	Status         JobStatus     `json:"status"`
+	ChunkSize      int           `json:"chunk_size"`
+	ChunkStride    int           `json:"chunk_stride"`
+	EmbeddingModel string        `json:"embedding_model"`
+	ContentHash    string        `json:"content_hash"`
+	ContentType    string        `json:"content_type,omitempty"` // sniffed MIME type, picks the extractor
+	OnDuplicate    string        `json:"on_duplicate"`
+	DocumentID     string        `json:"document_id,omitempty"` // ID of the document this upload becomes
+	FileID         string        `json:"file_id,omitempty"`     // file this upload becomes a version of
+	Version        int           `json:"version,omitempty"`     // version of the file this upload becomes
+	Size           int64         `json:"size,omitempty"`        // bytes
+	UploadedBy     string        `json:"uploaded_by,omitempty"`
+	Progress       string        `json:"progress,omitempty"`
+	Error          string        `json:"error,omitempty"`
+	Checkpoint     int           `json:"checkpoint"`
+	Result         *IngestResult `json:"result,omitempty"`
+	CreatedAt      time.Time     `json:"created_at"`
+	UpdatedAt      time.Time     `json:"updated_at"`
+
+	path       string          // uploaded file, removed when the job ends
+	ctx        context.Context // cancelled by Cancel
+	cancel     context.CancelFunc
+	publishing bool                     // set once the job publishes its version; Cancel refuses from then on
+	messages   []map[string]interface{} // NDJSON stream history
+	changed    chan struct{}            // closed and replaced whenever messages change
+}
+
+// JobManager queues ingestion jobs and runs them on a fixed number of workers.
+// Every job is persisted in a jobStore so unfinished work survives a restart.
+type JobManager struct {
+	mu    sync.Mutex
+	jobs  map[string]*Job
+	queue chan *Job
+	store *jobStore
+	run   func(*Job)
+}
+
+// NewJobManager loads the jobs persisted in store, requeues the ones that had
+// not finished and starts workers goroutines that pass queued jobs to run.
+func NewJobManager(workers int, store *jobStore, run func(*Job)) (*JobManager, error) {
+	m := &JobManager{
+		jobs:  make(map[string]*Job),
+		queue: make(chan *Job, 1024),
+		store: store,
+		run:   run,
+	}
+
+	jobs, err := store.load()
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].CreatedAt.Before(jobs[j].CreatedAt) })
+	for _, job := range jobs {
+		m.restore(job)
+	}
+	m.mu.Lock()
+	m.pruneLocked()
+	m.mu.Unlock()
+
+	for i := 0; i < workers; i++ {
+		go m.worker()
+	}
+	return m, nil
+}
+
+// restore registers a job loaded from the store. Jobs that were queued or
+// running when the server stopped are queued again from their checkpoint.
+func (m *JobManager) restore(job *Job) {
+	job.changed = make(chan struct{})
+	job.ctx, job.cancel = context.WithCancel(context.Background())
+	m.jobs[job.ID] = job
+
+	if job.finished() {
+		job.cancel()
+		if job.path != "" {
+			os.Remove(job.path)
+		}
+		return
+	}
+
+	if _, err := os.Stat(job.path); err != nil {
+		log.Printf("[JOB RESUME ERROR] Job: %s | File: %s | Uploaded file unavailable: %v", job.ID, job.Filename, err)
+		job.cancel()
+		m.setStatus(job, JobFailed, "uploaded file lost before the job finished")
+		return
+	}
+
+	if job.ContentHash == "" {
+		// Queued before uploads were hashed; keep their original behaviour
+		hash, err := hashFile(job.path)
+		if err != nil {
+			log.Printf("[JOB RESUME ERROR] Job: %s | File: %s | Failed to hash upload: %v", job.ID, job.Filename, err)
+			job.cancel()
+			m.setStatus(job, JobFailed, "failed to hash uploaded file")
+			return
+		}
+		job.ContentHash = hash
+		job.OnDuplicate = DuplicateKeep
+	}
+	if job.ContentType == "" {
+		// Queued when only PDFs could be uploaded
+		job.ContentType = MimePDF
+	}
+	if job.DocumentID == "" {
+		// Queued before documents had IDs
+		job.DocumentID = uuid.NewString()
+		if info, err := os.Stat(job.path); err == nil {
+			job.Size = info.Size()
+		}
+	}
+
+	log.Printf("[JOB RESUME] Job: %s | File: %s | Status: %s | Checkpoint: %d", job.ID, job.Filename, job.Status, job.Checkpoint)
+	m.setStatus(job, JobQueued, "")
+	select {
+	case m.queue <- job:
+	default:
+		job.cancel()
+		m.setStatus(job, JobFailed, "job queue is full")
+	}
+}
+
+// createUploadFile creates the file an upload is saved to before it is
+// queued. It lives in the job store so a resumed job can read it again.
+func (m *JobManager) createUploadFile() (*os.File, error) {
+	return m.store.createUpload()
+}
+
+func (m *JobManager) worker() {
+	for job := range m.queue {
+		if job.ctx.Err() == nil {
+			m.setStatus(job, JobRunning, "")
+			m.run(job)
+		}
+		job.cancel()
+		if job.path != "" {
+			os.Remove(job.path)
+		}
+	}
+}
+
+// Enqueue registers a new job and queues it for processing.
+func (m *JobManager) Enqueue(job *Job) error {
+	now := time.Now()
+	job.ID = uuid.New().String()
+	job.Status = JobQueued
+	job.CreatedAt = now
+	job.UpdatedAt = now
+	job.changed = make(chan struct{})
+	job.ctx, job.cancel = context.WithCancel(context.Background())
+
+	m.mu.Lock()
+	m.jobs[job.ID] = job
+	m.saveLocked(job)
+	m.pruneLocked()
+	m.mu.Unlock()
+
+	select {
+	case m.queue <- job:
+		return nil
+	default:
+		m.setStatus(job, JobFailed, "job queue is full")
+		return fmt.Errorf("job queue is full")
+	}
+}
+
+// Cancel stops a queued or running job. A queued job is marked cancelled
+// right away; a running job is marked by its run callback once it has
+// stopped and cleaned up. A job that has started publishing its version can
+// no longer be cancelled.
+func (m *JobManager) Cancel(id string) (Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	job, ok := m.jobs[id]
+	if !ok {
+		return Job{}, errJobNotFound
+	}
+	if job.finished() {
+		return *job, errJobFinished
+	}
+	if job.publishing {
+		return *job, errJobPublishing
+	}
+	m.cancelLocked(job)
+	return *job, nil
+}
+
+// CancelMatching cancels every unfinished job match returns true for, like
+// Cancel. If one of them is already publishing its version it cancels none
+// and returns errJobPublishing.
+func (m *JobManager) CancelMatching(match func(*Job) bool) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var jobs []*Job
+	for _, job := range m.jobs {
+		if job.finished() || !match(job) {
+			continue
+		}
+		if job.publishing {
+			return 0, errJobPublishing
+		}
+		jobs = append(jobs, job)
+	}
+	for _, job := range jobs {
+		m.cancelLocked(job)
+	}
+	return len(jobs), nil
+}
+
+func (m *JobManager) cancelLocked(job *Job) {
+	job.cancel()
+	if job.Status == JobQueued {
+		job.Status = JobCancelled
+		job.Error = "cancelled before start"
+		job.messages = append(job.messages, map[string]interface{}{"error": "upload cancelled"})
+		job.UpdatedAt = time.Now()
+		m.saveLocked(job)
+		m.notifyLocked(job)
+	}
+}
+
+// startPublishing marks a job as publishing, after which Cancel refuses it.
+// It returns false if the job was cancelled first.
+func (m *JobManager) startPublishing(job *Job) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if job.ctx.Err() != nil {
+		return false
+	}
+	job.publishing = true
+	return true
+}
+
+// Get returns a snapshot of the job with the given ID.
+func (m *JobManager) Get(id string) (Job, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	job, ok := m.jobs[id]
+	if !ok {
+		return Job{}, false
+	}
+	return *job, true
+}
+
+// List returns snapshots of all known jobs, newest first.
+func (m *JobManager) List() []Job {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	jobs := make([]Job, 0, len(m.jobs))
+	for _, job := range m.jobs {
+		jobs = append(jobs, *job)
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].CreatedAt.After(jobs[j].CreatedAt) })
+	return jobs
+}
+
+// Publish appends a message to the job's NDJSON stream.
+func (m *JobManager) Publish(job *Job, msg map[string]interface{}) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if status, ok := msg["status"].(string); ok {
+		job.Progress = status
+	}
+	job.messages = append(job.messages, msg)
+	job.UpdatedAt = time.Now()
+	m.notifyLocked(job)
+}
+
+// Checkpoint records that the first n chunks of the job have been processed
+// with the given result so far.
+func (m *JobManager) Checkpoint(job *Job, n int, result IngestResult) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if n <= job.Checkpoint {
+		return
+	}
+	job.Checkpoint = n
+	job.Result = &result
+	job.UpdatedAt = time.Now()
+	m.saveLocked(job)
+}
+
+// setVersion records the file and version number reserved for the job.
+func (m *JobManager) setVersion(job *Job, fileID string, version int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	job.FileID = fileID
+	job.Version = version
+	job.UpdatedAt = time.Now()
+	m.saveLocked(job)
+}
+
+// setResult records the final result of a job.
+func (m *JobManager) setResult(job *Job, result IngestResult) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	job.Result = &result
+	job.UpdatedAt = time.Now()
+	m.saveLocked(job)
+}
+
+func (m *JobManager) setStatus(job *Job, status JobStatus, errMsg string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	job.Status = status
+	job.Error = errMsg
+	job.UpdatedAt = time.Now()
+	m.saveLocked(job)
+	m.notifyLocked(job)
+}
+
+// saveLocked persists the job. Failures are logged; the job carries on in
+// memory. Callers must hold m.mu.
+func (m *JobManager) saveLocked(job *Job) {
+	if err := m.store.save(job); err != nil {
+		log.Printf("[JOB STORE ERROR] Job: %s | File: %s | Failed to persist: %v", job.ID, job.Filename, err)
+	}
+}
+
+// notifyLocked wakes every stream waiting on the job. Callers must hold m.mu.
+func (m *JobManager) notifyLocked(job *Job) {
+	close(job.changed)
+	job.changed = make(chan struct{})
+}
+
+// pruneLocked drops the oldest finished jobs beyond maxFinishedJobs.
+// Callers must hold m.mu.
+func (m *JobManager) pruneLocked() {
+	var finished []*Job
+	for _, job := range m.jobs {
+		if job.finished() {
+			finished = append(finished, job)
+		}
+	}
+	if len(finished) <= maxFinishedJobs {
+		return
+	}
+	sort.Slice(finished, func(i, j int) bool { return finished[i].UpdatedAt.Before(finished[j].UpdatedAt) })
+	for _, job := range finished[:len(finished)-maxFinishedJobs] {
+		delete(m.jobs, job.ID)
+		if err := m.store.remove(job.ID); err != nil {
+			log.Printf("[JOB STORE ERROR] Job: %s | Failed to remove record: %v", job.ID, err)
+		}
+	}
+}
+
+// next returns the job's messages from index from onwards, whether the job
+// has finished, and a channel that is closed on the next change.
+func (m *JobManager) next(id string, from int) ([]map[string]interface{}, bool, <-chan struct{}, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	job, ok := m.jobs[id]
+	if !ok {
+		return nil, false, nil, false
+	}
+	var msgs []map[string]interface{}
+	if from < len(job.messages) {
+		msgs = job.messages[from:]
+	}
+	return msgs, job.finished(), job.changed, true
+}
+
+func (j *Job) finished() bool {
+	return j.Status == JobCompleted || j.Status == JobFailed || j.Status == JobCancelled
+}
+
+// runJob is the JobManager callback that ingests an uploaded file.
+func (h *Handler) runJob(job *Job) {
+	progress := func(msg string) {
+		h.jobs.Publish(job, map[string]interface{}{"status": msg})
+	}
+
+	// Only a job that stopped because of the cancel is rolled back; once it
+	// publishes, its version is live and Cancel refuses it
+	result, err := h.processFile(job.ctx, job, progress)
+	if errors.Is(err, context.Canceled) {
+		log.Printf("[JOB CANCELLED] Job: %s | File: %s | Rolling back stored chunks", job.ID, job.Filename)
+		h.rollbackJob(job)
+		h.jobs.Publish(job, map[string]interface{}{"error": "upload cancelled"})
+		h.jobs.setStatus(job, JobCancelled, "cancelled")
+		return
+	}
+	h.jobs.setResult(job, result)
+	if err != nil {
+		// Do not leave a partially indexed file behind
+		log.Printf("[JOB FAILED] Job: %s | File: %s | Error: %v", job.ID, job.Filename, err)
+		if result.ChunksStored > 0 {
+			h.rollbackJob(job)
+		}
+		h.jobs.Publish(job, map[string]interface{}{"error": err.Error(), "result": result})
+		h.jobs.setStatus(job, JobFailed, err.Error())
+		return
+	}
+
+	log.Printf("[UPLOAD COMPLETE] Job: %s | File: %s | Version: %d | Stored: %d/%d chunks | Failed: %d",
+		job.ID, job.Filename, job.Version, result.ChunksStored, result.ChunksCreated, result.ChunksFailed)
+	h.jobs.Publish(job, map[string]interface{}{
+		"status":      "completed",
+		"filename":    job.Filename,
+		"document_id": job.DocumentID,
+		"version":     job.Version,
+		"chunkSize":   job.ChunkSize,
+		"chunkStride": job.ChunkStride,
+		"result":      result,
+	})
+	h.jobs.setStatus(job, JobCompleted, "")
+}
+
+// rollbackJob removes every chunk a job has written so far, and the original
+// file if it was already stored.
+func (h *Handler) rollbackJob(job *Job) {
+	if job.DocumentID != "" {
+		if err := h.blobs.Delete(context.Background(), job.DocumentID); err != nil {
+			log.Printf("[JOB ROLLBACK ERROR] Job: %s | File: %s | Failed to delete original: %v", job.ID, job.Filename, err)
+		}
+	}
+	if err := h.store.Delete(context.Background(), Filter{"job_id": job.ID}); err != nil {
+		log.Printf("[JOB ROLLBACK ERROR] Job: %s | File: %s | Error: %v", job.ID, job.Filename, err)
+		return
+	}
+	log.Printf("[JOB ROLLBACK] Job: %s | File: %s | Removed stored chunks", job.ID, job.Filename)
+}
+
+// HandleJobs lists all known ingestion jobs.
+func (h *Handler) HandleJobs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"jobs": h.jobs.List()})
+}
+
+// HandleJob serves /api/jobs/{id} (GET for status, DELETE to cancel) and
+// /api/jobs/{id}/stream (NDJSON progress, replayed from the start and
+// followed until the job ends).
+func (h *Handler) HandleJob(w http.ResponseWriter, r *http.Request) {
+	id, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/api/jobs/"), "/")
+	if id == "" {
+		http.Error(w, "Job ID required", http.StatusBadRequest)
+		return
+	}
+
+	if r.Method == http.MethodDelete && action == "" {
+		h.cancelJob(w, id)
+		return
+	}
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	switch action {
+	case "":
+		job, ok := h.jobs.Get(id)
+		if !ok {
+			http.Error(w, "Job not found", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(job)
+	case "stream":
+		h.streamJob(w, r, id)
+	default:
+		http.Error(w, "Not found", http.StatusNotFound)
+	}
+}
+
+func (h *Handler) cancelJob(w http.ResponseWriter, id string) {
+	job, err := h.jobs.Cancel(id)
+	switch {
+	case errors.Is(err, errJobNotFound):
+		http.Error(w, "Job not found", http.StatusNotFound)
+		return
+	case errors.Is(err, errJobFinished):
+		http.Error(w, fmt.Sprintf("Job already %s", job.Status), http.StatusConflict)
+		return
+	case errors.Is(err, errJobPublishing):
+		http.Error(w, "Job is publishing its version and can no longer be cancelled", http.StatusConflict)
+		return
+	}
+
+	log.Printf("[JOB CANCEL REQUESTED] Job: %s | File: %s", job.ID, job.Filename)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(job)
+}
+
+func (h *Handler) streamJob(w http.ResponseWriter, r *http.Request, id string) {
+	if _, ok := h.jobs.Get(id); !ok {
+		http.Error(w, "Job not found", http.StatusNotFound)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+
+	enc := json.NewEncoder(w)
+	sent := 0
+	for {
+		msgs, done, changed, ok := h.jobs.next(id, sent)
+		if !ok {
+			return // job was pruned
+		}
+		for _, msg := range msgs {
+			enc.Encode(msg)
+		}
+		sent += len(msgs)
+		flusher.Flush()
+
+		if done {
+			return
+		}
+
+		select {
+		case <-changed:
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package document
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// jobRecord is the on-disk form of a job. The uploaded file path is kept so
+// an unfinished job can be resumed after a restart.
+type jobRecord struct {
+	Job
+	Path string `json:"path"`
+}
+
+// jobStore persists ingestion jobs as one JSON file per job in dir, next to
+// the uploaded files they process.
+type jobStore struct {
+	dir string
+}
+
+func newJobStore(dir string) (*jobStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create job store directory %s: %w", dir, err)
+	}
+	return &jobStore{dir: dir}, nil
+}
+
+func (s *jobStore) recordPath(id string) string {
+	return filepath.Join(s.dir, id+".json")
+}
+
+// createUpload creates a file in the store directory to hold an upload until
+// its job has finished.
+func (s *jobStore) createUpload() (*os.File, error) {
+	return os.CreateTemp(s.dir, "upload-*")
+}
+
+func (s *jobStore) save(job *Job) error {
+	data, err := json.MarshalIndent(jobRecord{Job: *job, Path: job.path}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode job %s: %w", job.ID, err)
+	}
+	return writeFileAtomic(s.recordPath(job.ID), data)
+}
+
+func (s *jobStore) remove(id string) error {
+	if err := os.Remove(s.recordPath(id)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// load reads every persisted job. Unreadable records are logged and skipped.
+func (s *jobStore) load() ([]*Job, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read job store directory %s: %w", s.dir, err)
+	}
+
+	var jobs []*Job
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, ".json") || strings.HasPrefix(name, ".") {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(s.dir, name))
+		if err != nil {
+			log.Printf("[JOB STORE WARNING] Failed to read %s: %v", name, err)
+			continue
+		}
+		var rec jobRecord
+		if err := json.Unmarshal(data, &rec); err != nil || rec.ID == "" {
+			log.Printf("[JOB STORE WARNING] Skipping invalid job record %s: %v", name, err)
+			continue
+		}
+		job := rec.Job
+		job.path = rec.Path
+		jobs = append(jobs, &job)
+	}
+	return jobs, nil
+}
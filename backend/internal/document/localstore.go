@@ -0,0 +1,525 @@
+package document
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"sync"
+)
+
+// LocalStore is an in-process VectorStore. It answers queries by brute-force
+// cosine similarity. Every change is appended to a log in dir, and the log is
+// folded into a JSON snapshot of the collection once it grows larger than the
+// snapshot, so each write costs the size of the change rather than of the
+// collection.
+type LocalStore struct {
+	path    string // snapshot
+	logPath string
+
+	mu       sync.RWMutex
+	dims     int
+	records  map[string]*localRecord
+	log      *os.File
+	logSize  int64 // bytes of complete changes in the log
+	snapSize int64
+}
+
+type localRecord struct {
+	ID        string                 `json:"id"`
+	Text      string                 `json:"text"`
+	Embedding []float32              `json:"embedding"`
+	Metadata  map[string]interface{} `json:"metadata"`
+
+	norm float64
+}
+
+type localSnapshot struct {
+	Dimensions int            `json:"dimensions"`
+	Records    []*localRecord `json:"records"`
+}
+
+// localChange is one line of the log. Deletes and metadata updates list the
+// records they matched, so replaying the log does not depend on filters.
+// Every change sets values rather than adjusting them, so replaying a log
+// that was already folded into the snapshot leaves the snapshot as it is.
+type localChange struct {
+	Op         string                 `json:"op"` // "upsert", "delete", "set" or "drop"
+	Dimensions int                    `json:"dimensions,omitempty"`
+	Records    []*localRecord         `json:"records,omitempty"`
+	IDs        []string               `json:"ids,omitempty"`
+	Values     map[string]interface{} `json:"values,omitempty"`
+}
+
+// localCompactMin is the log size below which the log is never compacted, so
+// a small collection is not rewritten on every change.
+const localCompactMin = 1 << 20
+
+// NewLocalStore opens (or creates) the collection stored in dir.
+func NewLocalStore(dir, collection string) (*LocalStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create store directory %s: %w", dir, err)
+	}
+
+	s := &LocalStore{
+		path:    filepath.Join(dir, collection+".json"),
+		logPath: filepath.Join(dir, collection+".log"),
+		records: make(map[string]*localRecord),
+	}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// load reads the snapshot and replays the log on top of it.
+func (s *LocalStore) load() error {
+	data, err := os.ReadFile(s.path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to read %s: %w", s.path, err)
+	}
+	if err == nil {
+		var snap localSnapshot
+		if err := json.Unmarshal(data, &snap); err != nil {
+			return fmt.Errorf("failed to decode %s: %w", s.path, err)
+		}
+		s.dims = snap.Dimensions
+		for _, rec := range snap.Records {
+			rec.norm = vectorNorm(rec.Embedding)
+			s.records[rec.ID] = rec
+		}
+		s.snapSize = int64(len(data))
+	}
+
+	s.log, err = os.OpenFile(s.logPath, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", s.logPath, err)
+	}
+	r := bufio.NewReader(s.log)
+	for {
+		line, err := r.ReadBytes('\n')
+		if errors.Is(err, io.EOF) && len(line) == 0 {
+			break
+		}
+		var change localChange
+		if err == nil {
+			err = json.Unmarshal(line, &change)
+		}
+		if err != nil {
+			// A crash while appending leaves the last change unfinished;
+			// it was never acknowledged, so it is dropped
+			if _, more := r.Peek(1); more == nil {
+				return fmt.Errorf("failed to decode %s at byte %d: %w", s.logPath, s.logSize, err)
+			}
+			log.Printf("[LOCAL STORE WARNING] Log: %s | Dropping unfinished change at byte %d: %v", s.logPath, s.logSize, err)
+			if err := s.log.Truncate(s.logSize); err != nil {
+				return fmt.Errorf("failed to truncate %s: %w", s.logPath, err)
+			}
+			break
+		}
+		s.apply(&change)
+		s.logSize += int64(len(line))
+	}
+	return nil
+}
+
+// apply replays a change read from the log.
+func (s *LocalStore) apply(change *localChange) {
+	switch change.Op {
+	case "upsert":
+		s.dims = change.Dimensions
+		for _, rec := range change.Records {
+			rec.norm = vectorNorm(rec.Embedding)
+			s.records[rec.ID] = rec
+		}
+	case "delete":
+		for _, id := range change.IDs {
+			delete(s.records, id)
+		}
+	case "set":
+		for _, id := range change.IDs {
+			if rec, ok := s.records[id]; ok {
+				if rec.Metadata == nil {
+					rec.Metadata = make(map[string]interface{})
+				}
+				for k, v := range change.Values {
+					rec.Metadata[k] = v
+				}
+			}
+		}
+	case "drop":
+		s.records = make(map[string]*localRecord)
+		s.dims = 0
+	}
+}
+
+// record appends a change to the log and syncs it, then compacts the log
+// once it is larger than the snapshot. Callers must hold s.mu and undo the
+// change in memory when it fails.
+func (s *LocalStore) record(change localChange) error {
+	data, err := json.Marshal(change)
+	if err != nil {
+		return fmt.Errorf("failed to encode change: %w", err)
+	}
+	data = append(data, '\n')
+	if _, err := s.log.Write(data); err == nil {
+		err = s.log.Sync()
+	}
+	if err != nil {
+		// Cut off whatever part of the change made it, so later changes
+		// are not appended to a broken line
+		s.log.Truncate(s.logSize)
+		return fmt.Errorf("failed to append to %s: %w", s.logPath, err)
+	}
+	s.logSize += int64(len(data))
+
+	if s.logSize > max(localCompactMin, s.snapSize) {
+		if err := s.compact(); err != nil {
+			// The change is safe in the log; compaction is retried on the next write
+			log.Printf("[LOCAL STORE WARNING] Log: %s | Failed to compact: %v", s.logPath, err)
+		}
+	}
+	return nil
+}
+
+// compact writes the current records as the new snapshot and empties the
+// log. A crash in between only means the log is replayed over a snapshot
+// that already holds its changes. Callers must hold s.mu.
+func (s *LocalStore) compact() error {
+	snap := localSnapshot{
+		Dimensions: s.dims,
+		Records:    make([]*localRecord, 0, len(s.records)),
+	}
+	for _, rec := range s.records {
+		snap.Records = append(snap.Records, rec)
+	}
+	sort.Slice(snap.Records, func(i, j int) bool { return snap.Records[i].ID < snap.Records[j].ID })
+
+	data, err := json.Marshal(snap)
+	if err != nil {
+		return fmt.Errorf("failed to encode snapshot: %w", err)
+	}
+	if err := writeFileAtomic(s.path, data); err != nil {
+		return err
+	}
+	s.snapSize = int64(len(data))
+	if err := s.log.Truncate(0); err != nil {
+		return fmt.Errorf("failed to truncate %s: %w", s.logPath, err)
+	}
+	s.logSize = 0
+	return nil
+}
+
+func (s *LocalStore) Upsert(ctx context.Context, chunks []Chunk) error {
+	if len(chunks) == 0 {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	dims := s.dims
+	if len(s.records) == 0 {
+		dims = 0
+	}
+	metas := make([]map[string]interface{}, len(chunks))
+	for i, c := range chunks {
+		if dims == 0 {
+			dims = len(c.Embedding)
+		}
+		if len(c.Embedding) != dims {
+			return fmt.Errorf("embedding for chunk %s has %d dimensions, collection uses %d", c.ID, len(c.Embedding), dims)
+		}
+		// Store metadata as it will look after a reload from disk
+		meta, err := normalizeMetadata(c.Metadata)
+		if err != nil {
+			return fmt.Errorf("invalid metadata for chunk %s: %w", c.ID, err)
+		}
+		metas[i] = meta
+	}
+
+	// Keep the previous records so a failed write leaves memory and disk in agreement.
+	previous := make(map[string]*localRecord, len(chunks))
+	change := localChange{Op: "upsert", Dimensions: dims, Records: make([]*localRecord, len(chunks))}
+	for i, c := range chunks {
+		meta := metas[i]
+		if _, seen := previous[c.ID]; !seen {
+			previous[c.ID] = s.records[c.ID]
+		}
+		rec := &localRecord{
+			ID:        c.ID,
+			Text:      c.Text,
+			Embedding: c.Embedding,
+			Metadata:  meta,
+			norm:      vectorNorm(c.Embedding),
+		}
+		s.records[c.ID] = rec
+		change.Records[i] = rec
+	}
+	oldDims := s.dims
+	s.dims = dims
+
+	if err := s.record(change); err != nil {
+		for id, rec := range previous {
+			if rec == nil {
+				delete(s.records, id)
+			} else {
+				s.records[id] = rec
+			}
+		}
+		s.dims = oldDims
+		return err
+	}
+	return nil
+}
+
+func (s *LocalStore) Query(ctx context.Context, embedding []float32, n int, where Filter) ([]QueryResult, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if len(s.records) > 0 && len(embedding) != s.dims {
+		return nil, fmt.Errorf("query embedding has %d dimensions, collection uses %d", len(embedding), s.dims)
+	}
+
+	queryNorm := vectorNorm(embedding)
+	results := make([]QueryResult, 0, len(s.records))
+	for _, rec := range s.records {
+		if !matchesFilter(rec.Metadata, where) {
+			continue
+		}
+		results = append(results, QueryResult{
+			ID:       rec.ID,
+			Text:     rec.Text,
+			Metadata: copyMetadata(rec.Metadata),
+			Distance: cosineDistance(embedding, queryNorm, rec.Embedding, rec.norm),
+		})
+	}
+
+	sort.Slice(results, func(i, j int) bool { return results[i].Distance < results[j].Distance })
+	if n >= 0 && len(results) > n {
+		results = results[:n]
+	}
+	return results, nil
+}
+
+func (s *LocalStore) Delete(ctx context.Context, where Filter) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	removed := make(map[string]*localRecord)
+	change := localChange{Op: "delete"}
+	for id, rec := range s.records {
+		if matchesFilter(rec.Metadata, where) {
+			removed[id] = rec
+			delete(s.records, id)
+			change.IDs = append(change.IDs, id)
+		}
+	}
+	if len(removed) == 0 {
+		return nil
+	}
+
+	if err := s.record(change); err != nil {
+		for id, rec := range removed {
+			s.records[id] = rec
+		}
+		return err
+	}
+	return nil
+}
+
+func (s *LocalStore) SetMetadata(ctx context.Context, where Filter, values map[string]interface{}) error {
+	values, err := normalizeMetadata(values)
+	if err != nil {
+		return fmt.Errorf("invalid metadata: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previous := make(map[*localRecord]map[string]interface{})
+	change := localChange{Op: "set", Values: values}
+	for _, rec := range s.records {
+		if !matchesFilter(rec.Metadata, where) {
+			continue
+		}
+		previous[rec] = rec.Metadata
+		change.IDs = append(change.IDs, rec.ID)
+		meta := copyMetadata(rec.Metadata)
+		for k, v := range values {
+			meta[k] = v
+		}
+		rec.Metadata = meta
+	}
+	if len(previous) == 0 {
+		return nil
+	}
+
+	if err := s.record(change); err != nil {
+		for rec, meta := range previous {
+			rec.Metadata = meta
+		}
+		return err
+	}
+	return nil
+}
+
+func (s *LocalStore) Count(ctx context.Context) (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.records), nil
+}
+
+func (s *LocalStore) ListMetadata(ctx context.Context, where Filter) ([]map[string]interface{}, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var metadatas []map[string]interface{}
+	for _, rec := range s.records {
+		if matchesFilter(rec.Metadata, where) {
+			metadatas = append(metadatas, copyMetadata(rec.Metadata))
+		}
+	}
+	return metadatas, nil
+}
+
+func (s *LocalStore) DropCollection(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// The drop is logged first, so a crash before the empty snapshot is
+	// written replays it rather than the old snapshot or log
+	records, dims := s.records, s.dims
+	s.records = make(map[string]*localRecord)
+	s.dims = 0
+	if err := s.record(localChange{Op: "drop"}); err != nil {
+		s.records, s.dims = records, dims
+		return err
+	}
+	if s.logSize > 0 {
+		if err := s.compact(); err != nil {
+			log.Printf("[LOCAL STORE WARNING] Log: %s | Failed to compact: %v", s.logPath, err)
+		}
+	}
+	return nil
+}
+
+// writeFileAtomic replaces path with data so that a crash leaves either the
+// old or the new contents on disk, never a partial file.
+func writeFileAtomic(path string, data []byte) error {
+	dir := filepath.Dir(path)
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %w", err)
+	}
+	tmpName := tmp.Name()
+	defer os.Remove(tmpName) // no-op once renamed
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write %s: %w", tmpName, err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to sync %s: %w", tmpName, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close %s: %w", tmpName, err)
+	}
+	if err := os.Rename(tmpName, path); err != nil {
+		return fmt.Errorf("failed to rename %s: %w", tmpName, err)
+	}
+
+	// Sync the directory so the rename itself survives a crash.
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+	return nil
+}
+
+func matchesFilter(metadata map[string]interface{}, where Filter) bool {
+	for k, want := range where {
+		got, ok := metadata[k]
+		if !ok || !metadataValueEqual(got, want) {
+			return false
+		}
+	}
+	return true
+}
+
+// metadataValueEqual compares metadata values, treating all numeric types as
+// equal when their values match (JSON round-trips turn ints into float64).
+func metadataValueEqual(a, b interface{}) bool {
+	if fa, ok := toFloat64(a); ok {
+		fb, ok := toFloat64(b)
+		return ok && fa == fb
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+func toFloat64(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case int:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case float32:
+		return float64(n), true
+	case float64:
+		return n, true
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	}
+	return 0, false
+}
+
+func normalizeMetadata(m map[string]interface{}) (map[string]interface{}, error) {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[string]interface{})
+	if err := json.Unmarshal(data, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func copyMetadata(m map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		out[k] = v
+	}
+	return out
+}
+
+func vectorNorm(v []float32) float64 {
+	var sum float64
+	for _, x := range v {
+		sum += float64(x) * float64(x)
+	}
+	return math.Sqrt(sum)
+}
+
+func cosineDistance(a []float32, normA float64, b []float32, normB float64) float32 {
+	if normA == 0 || normB == 0 {
+		return 1
+	}
+	var dot float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+	}
+	return float32(1 - dot/(normA*normB))
+}
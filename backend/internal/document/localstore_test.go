@@ -0,0 +1,73 @@
+package document
+
+import (
+	"context"
+	"testing"
+)
+
+// filledLocalStore opens a collection in dir with one record in the snapshot
+// and one only in the log.
+func filledLocalStore(t *testing.T, dir string) *LocalStore {
+	t.Helper()
+	ctx := context.Background()
+	s := openLocalStore(t, dir)
+	if err := s.Upsert(ctx, []Chunk{{ID: "a", Text: "a", Embedding: []float32{1, 0}}}); err != nil {
+		t.Fatal(err)
+	}
+	s.mu.Lock()
+	err := s.compact()
+	s.mu.Unlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Upsert(ctx, []Chunk{{ID: "b", Text: "b", Embedding: []float32{0, 1}}}); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// openLocalStore opens the collection in dir, as after a restart.
+func openLocalStore(t *testing.T, dir string) *LocalStore {
+	t.Helper()
+	s, err := NewLocalStore(dir, "docs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.log.Close() })
+	return s
+}
+
+func TestLocalStoreDropCollection(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	s := filledLocalStore(t, dir)
+	if err := s.DropCollection(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	s = openLocalStore(t, dir)
+	if n, _ := s.Count(ctx); n != 0 {
+		t.Errorf("%d records after the drop, want 0", n)
+	}
+	// A dropped collection takes embeddings of any size
+	if err := s.Upsert(ctx, []Chunk{{ID: "c", Text: "c", Embedding: []float32{1, 0, 0}}}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLocalStoreDropCollectionCrash(t *testing.T) {
+	dir := t.TempDir()
+	s := filledLocalStore(t, dir)
+	// Stop after the drop is logged, before the empty snapshot is written
+	s.mu.Lock()
+	err := s.record(localChange{Op: "drop"})
+	s.mu.Unlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s = openLocalStore(t, dir)
+	if n, _ := s.Count(context.Background()); n != 0 {
+		t.Errorf("%d records after replaying the drop, want 0", n)
+	}
+}
@@ -0,0 +1,162 @@
+package document
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var (
+	atxHeading    = regexp.MustCompile(`^ {0,3}(#{1,6})(?:[ \t]+(.*?))?(?:[ \t]+#+)?[ \t]*$`)
+	setextHeading = regexp.MustCompile(`^ {0,3}(=+|-+)[ \t]*$`)
+	fenceOpen     = regexp.MustCompile("^ {0,3}(`{3,}|~{3,})")
+)
+
+// MarkdownExtractor extracts Markdown files. The text is kept as written;
+// each heading starts a section titled with its heading path, such as
+// "Install > Linux > Proxy", and fenced code blocks are kept verbatim. YAML
+// front matter is read for the title, author, description and date instead
+// of being indexed.
+type MarkdownExtractor struct{}
+
+func (MarkdownExtractor) Name() string { return "markdown" }
+
+func (MarkdownExtractor) Extract(ctx context.Context, path, filename string, progress func(string)) (*Content, error) {
+	if progress != nil {
+		progress("Reading Markdown file...")
+	}
+	text, err := readText(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	info, body := parseFrontMatter(text)
+	content := parseMarkdown(body)
+	if info.Title == "" {
+		info.Title = content.Info.Title
+	}
+	content.Info = info
+	return content, nil
+}
+
+// parseMarkdown finds the headings and fenced code blocks of a Markdown text.
+// The first top-level heading becomes the title.
+func parseMarkdown(text string) *Content {
+	content := &Content{Text: text}
+
+	var path headingPath
+	addHeading := func(level int, title string, offset int) {
+		if level == 1 && content.Info.Title == "" {
+			content.Info.Title = title
+		}
+		content.Sections = append(content.Sections, Section{Title: path.enter(level, title), Offset: offset})
+	}
+
+	var (
+		fence      string // closing marker of the open code fence, if any
+		fenceStart int
+		prevStart  = -1 // start of the previous line if it was paragraph text
+		prevText   string
+	)
+	for start := 0; start < len(text); {
+		end := strings.IndexByte(text[start:], '\n')
+		if end < 0 {
+			end = len(text)
+		} else {
+			end += start
+		}
+		line := strings.TrimSuffix(text[start:end], "\r")
+		next := end + 1
+
+		if fence != "" {
+			trimmed := strings.TrimSpace(line)
+			if strings.HasPrefix(trimmed, fence) && strings.Trim(trimmed, fence[:1]) == "" && len(line)-len(strings.TrimLeft(line, " ")) <= 3 {
+				content.Verbatim = append(content.Verbatim, Span{Start: fenceStart, End: start + len(line)})
+				fence = ""
+			}
+			start = next
+			continue
+		}
+
+		switch {
+		case fenceOpen.MatchString(line):
+			marker := fenceOpen.FindStringSubmatch(line)[1]
+			// Backtick fences cannot have backticks in their info string
+			if marker[0] != '`' || !strings.Contains(line[strings.Index(line, marker)+len(marker):], "`") {
+				fence, fenceStart = marker, start
+				prevStart = -1
+			}
+		case atxHeading.MatchString(line):
+			m := atxHeading.FindStringSubmatch(line)
+			if title := strings.TrimSpace(m[2]); title != "" {
+				addHeading(len(m[1]), title, start)
+			}
+			prevStart = -1
+		case prevStart >= 0 && setextHeading.MatchString(line):
+			level := 1
+			if strings.TrimSpace(line)[0] == '-' {
+				level = 2
+			}
+			addHeading(level, strings.TrimSpace(prevText), prevStart)
+			prevStart = -1
+		case strings.TrimSpace(line) == "":
+			prevStart = -1
+		default:
+			prevStart, prevText = start, line
+		}
+		start = next
+	}
+	if fence != "" {
+		// An unclosed fence runs to the end of the file
+		content.Verbatim = append(content.Verbatim, Span{Start: fenceStart, End: len(text)})
+	}
+	return content
+}
+
+// parseFrontMatter splits YAML front matter delimited by "---" lines off the
+// start of text and reads its title, author, description and date. Only
+// simple "key: value" lines are understood. Without front matter the text is
+// returned unchanged.
+func parseFrontMatter(text string) (DocumentInfo, string) {
+	var info DocumentInfo
+	if !strings.HasPrefix(text, "---\n") && !strings.HasPrefix(text, "---\r\n") {
+		return info, text
+	}
+
+	lines := strings.SplitAfter(text, "\n")
+	offset := len(lines[0])
+	for _, line := range lines[1:] {
+		offset += len(line)
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "---" || trimmed == "..." {
+			return info, text[offset:]
+		}
+
+		key, value, ok := strings.Cut(line, ":")
+		if !ok || strings.HasPrefix(key, " ") || strings.HasPrefix(key, "\t") {
+			continue
+		}
+		value = strings.Trim(strings.TrimSpace(value), `"'`)
+		switch strings.ToLower(strings.TrimSpace(key)) {
+		case "title":
+			info.Title = value
+		case "author":
+			info.Author = value
+		case "description", "subject":
+			info.Subject = value
+		case "date", "created":
+			for _, layout := range []string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02"} {
+				if t, err := time.Parse(layout, value); err == nil {
+					info.Created = t.Format(time.RFC3339)
+					break
+				}
+			}
+		}
+	}
+	// No closing line: not front matter after all
+	return DocumentInfo{}, text
+}
@@ -0,0 +1,189 @@
+package document
+
+import (
+	"context"
+	"testing"
+)
+
+func TestParseMarkdown(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		title    string
+		sections []wantSection
+		verbatim []string
+	}{
+		{
+			name:  "heading paths",
+			text:  "# Install\n\nIntro.\n\n## Linux\n\n### Proxy\n\nSet it.\n\n## macOS\n\n# Usage\n",
+			title: "Install",
+			sections: []wantSection{
+				{"Install", "# Install"},
+				{"Install > Linux", "## Linux"},
+				{"Install > Linux > Proxy", "### Proxy"},
+				{"Install > macOS", "## macOS"},
+				{"Usage", "# Usage"},
+			},
+		},
+		{
+			name:  "closing hashes and indentation",
+			text:  "   ## Setup ##\n\n#NoSpace is text\n\n#\n",
+			title: "",
+			sections: []wantSection{
+				{"Setup", "   ## Setup"},
+			},
+		},
+		{
+			name:  "setext headings",
+			text:  "Guide\n=====\n\nSome text.\n\nDetails\n-------\n\nMore.\n",
+			title: "Guide",
+			sections: []wantSection{
+				{"Guide", "Guide\n="},
+				{"Guide > Details", "Details\n-"},
+			},
+		},
+		{
+			name:  "thematic break after a blank line is not a heading",
+			text:  "Some text.\n\n---\n\nMore.\n",
+			title: "",
+		},
+		{
+			name:  "fenced code",
+			text:  "# Code\n\n```go\n# not a heading\nfunc main() {}\n```\n\n~~~~\nSetext?\n---\n~~~~\n",
+			title: "Code",
+			sections: []wantSection{
+				{"Code", "# Code"},
+			},
+			verbatim: []string{
+				"```go\n# not a heading\nfunc main() {}\n```",
+				"~~~~\nSetext?\n---\n~~~~",
+			},
+		},
+		{
+			name:     "fence closed only by a marker as long",
+			text:     "````\n```\n# inside\n````\n# After\n",
+			title:    "After",
+			sections: []wantSection{{"After", "# After"}},
+			verbatim: []string{"````\n```\n# inside\n````"},
+		},
+		{
+			name:     "unclosed fence runs to the end",
+			text:     "Text.\n\n```\ncode\n# inside\n",
+			verbatim: []string{"```\ncode\n# inside\n"},
+		},
+		{
+			name:  "backticks in the info string do not open a fence",
+			text:  "``` not `a` fence\n# Heading\n",
+			title: "Heading",
+			sections: []wantSection{
+				{"Heading", "# Heading"},
+			},
+		},
+		{
+			name:  "title is the first top-level heading",
+			text:  "## Preface\n\n# Book\n\n# Other\n",
+			title: "Book",
+			sections: []wantSection{
+				{"Preface", "## Preface"},
+				{"Book", "# Book"},
+				{"Other", "# Other"},
+			},
+		},
+		{
+			name:  "crlf line endings",
+			text:  "# One\r\n\r\nText.\r\n\r\nTwo\r\n---\r\n",
+			title: "One",
+			sections: []wantSection{
+				{"One", "# One"},
+				{"One > Two", "Two\r\n"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			content := parseMarkdown(tt.text)
+			if content.Text != tt.text {
+				t.Errorf("text was changed to %q", content.Text)
+			}
+			if content.Info.Title != tt.title {
+				t.Errorf("title = %q, want %q", content.Info.Title, tt.title)
+			}
+			checkSections(t, content.Text, content.Sections, tt.sections)
+			if len(content.Verbatim) != len(tt.verbatim) {
+				t.Fatalf("%d verbatim spans, want %d", len(content.Verbatim), len(tt.verbatim))
+			}
+			for i, v := range content.Verbatim {
+				if got := content.Text[v.Start:v.End]; got != tt.verbatim[i] {
+					t.Errorf("verbatim span %d = %q, want %q", i, got, tt.verbatim[i])
+				}
+			}
+		})
+	}
+}
+
+func TestParseFrontMatter(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		info DocumentInfo
+		body string
+	}{
+		{
+			name: "all fields",
+			text: "---\ntitle: \"Release notes\"\nauthor: Jane Doe\ndescription: What changed\ndate: 2024-03-01\ntags:\n  - title: nested\n---\n# Notes\n",
+			info: DocumentInfo{Title: "Release notes", Author: "Jane Doe", Subject: "What changed", Created: "2024-03-01T00:00:00Z"},
+			body: "# Notes\n",
+		},
+		{
+			name: "dots close it and crlf",
+			text: "---\r\ntitle: 'Quoted'\r\ncreated: 2024-03-01T10:20:30Z\r\n...\r\nBody\r\n",
+			info: DocumentInfo{Title: "Quoted", Created: "2024-03-01T10:20:30Z"},
+			body: "Body\r\n",
+		},
+		{
+			name: "unparseable date is left out",
+			text: "---\ndate: soon\n---\nBody\n",
+			body: "Body\n",
+		},
+		{
+			name: "no front matter",
+			text: "# Title\n---\n",
+			body: "# Title\n---\n",
+		},
+		{
+			name: "unclosed front matter is text",
+			text: "---\ntitle: Not front matter\n\nBody\n",
+			body: "---\ntitle: Not front matter\n\nBody\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info, body := parseFrontMatter(tt.text)
+			if info != tt.info {
+				t.Errorf("info = %+v, want %+v", info, tt.info)
+			}
+			if body != tt.body {
+				t.Errorf("body = %q, want %q", body, tt.body)
+			}
+		})
+	}
+}
+
+func TestMarkdownExtractor(t *testing.T) {
+	path := writeTemp(t, "notes.md", []byte("---\nauthor: Jane Doe\n---\n# Notes\n\nText.\n\n## Part\n"))
+	content, err := MarkdownExtractor{}.Extract(context.Background(), path, "notes.md", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if content.Text != "# Notes\n\nText.\n\n## Part\n" {
+		t.Errorf("front matter was indexed: %q", content.Text)
+	}
+	// The title falls back to the first heading
+	if want := (DocumentInfo{Title: "Notes", Author: "Jane Doe"}); content.Info != want {
+		t.Errorf("info = %+v, want %+v", content.Info, want)
+	}
+	checkSections(t, content.Text, content.Sections, []wantSection{
+		{"Notes", "# Notes"},
+		{"Notes > Part", "## Part"},
+	})
+}
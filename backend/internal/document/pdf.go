@@ -0,0 +1,215 @@
+package document
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ledongthuc/pdf"
+)
+
+// PDFOptions bounds how ReadPDF extracts pages.
+type PDFOptions struct {
+	Workers     int           // pages extracted in parallel
+	PageTimeout time.Duration // a page taking longer is skipped
+	Timeout     time.Duration // pages not extracted by then are skipped
+}
+
+// PDFContent is the text extracted from a PDF file.
+type PDFContent struct {
+	Text    string
+	Pages   int
+	Offsets []PageOffset  // where each extracted page starts in Text, in page order
+	Skipped []SkippedPage // pages whose text could not be extracted, in page order
+	Info    DocumentInfo
+	Outline []OutlineEntry // bookmarks, sorted by page
+}
+
+// PageOffset records that the text of Page starts at byte Offset of the
+// extracted text.
+type PageOffset struct {
+	Page   int
+	Offset int
+}
+
+// pageText is the outcome of extracting one page. skip is set when the page
+// was skipped and says why.
+type pageText struct {
+	text string
+	skip string
+	done bool
+}
+
+// ReadPDF extracts plain text from a PDF file at the given path, extracting
+// up to opts.Workers pages in parallel. Pages are joined in page order
+// whatever order they finish in. Pages that fail, take longer than
+// opts.PageTimeout, or are not done within opts.Timeout are skipped and
+// listed in the result. Reading stops with ctx.Err() once ctx is cancelled.
+func ReadPDF(ctx context.Context, path, filename string, opts PDFOptions, progress func(string)) (*PDFContent, error) {
+	f, r, err := pdf.Open(path)
+	if err != nil {
+		log.Printf("[PDF OPEN ERROR] File: %s | Error: %v", filename, err)
+		return nil, err
+	}
+	// Closing the file also makes abandoned extractions still reading it fail
+	// fast instead of running on
+	defer f.Close()
+
+	total := r.NumPage()
+	workers := max(1, min(opts.Workers, total))
+	log.Printf("[PDF READING] File: %s | Total pages: %d | Workers: %d", filename, total, workers)
+
+	content := &PDFContent{
+		Pages:   total,
+		Info:    readInfo(r, filename),
+		Outline: readOutline(r, filename),
+	}
+	log.Printf("[PDF METADATA] File: %s | Title: %q | Author: %q | Bookmarks: %d",
+		filename, content.Info.Title, content.Info.Author, len(content.Outline))
+
+	docCtx, cancel := context.WithTimeout(ctx, opts.Timeout)
+	defer cancel()
+
+	results := make([]pageText, total)
+	pages := make(chan int)
+	finished := make(chan int)
+
+	// A slot is held for as long as an extraction runs, including one that
+	// was abandoned after its page timed out, so hung pages can never tie up
+	// more than `workers` goroutines
+	slots := make(chan struct{}, workers)
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range pages {
+				res, ok := extractPage(docCtx, r, i, opts.PageTimeout, slots)
+				if !ok {
+					return // the document timed out or was cancelled
+				}
+				results[i-1] = res
+				finished <- i
+			}
+		}()
+	}
+
+	go func() {
+		defer close(pages)
+		for i := 1; i <= total; i++ {
+			select {
+			case pages <- i:
+			case <-docCtx.Done():
+				return
+			}
+		}
+	}()
+
+	go func() {
+		wg.Wait()
+		close(finished)
+	}()
+
+	count := 0
+	for i := range finished {
+		count++
+		if skip := results[i-1].skip; skip != "" {
+			log.Printf("[PDF PAGE SKIP] File: %s | Page: %d/%d | Reason: %s", filename, i, total, skip)
+			if progress != nil {
+				progress(fmt.Sprintf("Skipped page %d (%s)", i, skip))
+			}
+		}
+		// Report progress more frequently for small PDFs
+		if progress != nil && (total < 20 || count%5 == 0 || count == 1 || count == total) {
+			progress(fmt.Sprintf("Read %d/%d PDF pages", count, total))
+		}
+	}
+
+	if err := ctx.Err(); err != nil {
+		log.Printf("[PDF READING CANCELLED] File: %s | Pages read: %d/%d", filename, count, total)
+		return nil, err
+	}
+	if count < total {
+		log.Printf("[PDF READING TIMEOUT] File: %s | Pages read: %d/%d | Skipping the rest after %s",
+			filename, count, total, opts.Timeout)
+		if progress != nil {
+			progress(fmt.Sprintf("Stopped reading after %s, skipping %d pages", opts.Timeout, total-count))
+		}
+	}
+
+	var buf strings.Builder
+	for i, res := range results {
+		switch {
+		case !res.done:
+			content.Skipped = append(content.Skipped, SkippedPage{Page: i + 1, Reason: fmt.Sprintf("document timed out after %s", opts.Timeout)})
+		case res.skip != "":
+			content.Skipped = append(content.Skipped, SkippedPage{Page: i + 1, Reason: res.skip})
+		default:
+			content.Offsets = append(content.Offsets, PageOffset{Page: i + 1, Offset: buf.Len()})
+			buf.WriteString(res.text)
+		}
+	}
+
+	log.Printf("[PDF READING COMPLETE] File: %s | Pages processed: %d | Skipped: %d | Text length: %d chars",
+		filename, total, len(content.Skipped), buf.Len())
+	content.Text = buf.String()
+	return content, nil
+}
+
+// extractPage extracts the text of page i within timeout, once a slot is
+// free. The extraction cannot be interrupted, so on timeout it is abandoned
+// and keeps its slot until it returns. ok is false if ctx ends before the
+// page is done.
+func extractPage(ctx context.Context, r *pdf.Reader, i int, timeout time.Duration, slots chan struct{}) (res pageText, ok bool) {
+	select {
+	case slots <- struct{}{}:
+	case <-ctx.Done():
+		return res, false
+	}
+
+	// Buffered so an abandoned extraction can still finish and exit
+	ch := make(chan pageText, 1)
+	go func() {
+		defer func() { <-slots }()
+		ch <- readPage(r, i)
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case res := <-ch:
+		return res, true
+	case <-timer.C:
+		return pageText{skip: fmt.Sprintf("timed out after %s", timeout), done: true}, true
+	case <-ctx.Done():
+		return res, false
+	}
+}
+
+// readPage extracts the text of page i, turning failures into a skip reason.
+func readPage(r *pdf.Reader, i int) (res pageText) {
+	res.done = true
+	defer func() {
+		// Page lookups panic on malformed page trees
+		if err := recover(); err != nil {
+			res = pageText{skip: fmt.Sprint(err), done: true}
+		}
+	}()
+
+	p := r.Page(i)
+	if p.V.IsNull() {
+		res.skip = "null page"
+		return res
+	}
+	text, err := p.GetPlainText(nil)
+	if err != nil {
+		res.skip = err.Error()
+		return res
+	}
+	res.text = text
+	return res
+}
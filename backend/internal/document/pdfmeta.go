@@ -0,0 +1,213 @@
+package document
+
+import (
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ledongthuc/pdf"
+)
+
+// maxOutlineEntries bounds how many bookmarks are read, so a malformed
+// outline whose entries link back to each other cannot loop forever.
+const maxOutlineEntries = 10000
+
+// DocumentInfo is the descriptive metadata of a file, such as the PDF Info
+// dictionary. Empty fields were not set in the file.
+type DocumentInfo struct {
+	Title   string `json:"title,omitempty"`
+	Author  string `json:"author,omitempty"`
+	Subject string `json:"subject,omitempty"`
+	Created string `json:"created,omitempty"` // creation date, RFC 3339
+	URL     string `json:"url,omitempty"`     // canonical address of a web page
+}
+
+// metadata returns the chunk metadata fields for info. created_year lets
+// search filter by year with the stores' equality filters.
+func (info DocumentInfo) metadata() map[string]interface{} {
+	m := make(map[string]interface{})
+	for key, value := range map[string]string{"title": info.Title, "author": info.Author, "subject": info.Subject, "url": info.URL} {
+		if value != "" {
+			m[key] = value
+		}
+	}
+	if created, err := time.Parse(time.RFC3339, info.Created); err == nil {
+		m["created"] = info.Created
+		m["created_year"] = created.Year()
+	}
+	return m
+}
+
+// OutlineEntry is a bookmark of a PDF file and the page it points to.
+// Level is 1 for top-level bookmarks.
+type OutlineEntry struct {
+	Title string `json:"title"`
+	Page  int    `json:"page"`
+	Level int    `json:"level"`
+}
+
+// readInfo reads the Info dictionary of a PDF file. Malformed entries are
+// ignored.
+func readInfo(r *pdf.Reader, filename string) (info DocumentInfo) {
+	defer func() {
+		if err := recover(); err != nil {
+			log.Printf("[PDF INFO ERROR] File: %s | Error: %v", filename, err)
+			info = DocumentInfo{}
+		}
+	}()
+
+	dict := r.Trailer().Key("Info")
+	info.Title = strings.TrimSpace(dict.Key("Title").Text())
+	info.Author = strings.TrimSpace(dict.Key("Author").Text())
+	info.Subject = strings.TrimSpace(dict.Key("Subject").Text())
+	if created, ok := parsePDFDate(dict.Key("CreationDate").Text()); ok {
+		info.Created = created.Format(time.RFC3339)
+	}
+	return info
+}
+
+// parsePDFDate parses a PDF date string, D:YYYYMMDDHHmmSSOHH'mm'. Every part
+// after the year is optional; a missing time zone means UTC.
+func parsePDFDate(s string) (time.Time, bool) {
+	s = strings.TrimPrefix(strings.TrimSpace(s), "D:")
+
+	widths := []int{4, 2, 2, 2, 2, 2}
+	parts := []int{0, 1, 1, 0, 0, 0}
+	for n, width := range widths {
+		if len(s) < width {
+			break
+		}
+		v, err := strconv.Atoi(s[:width])
+		if err != nil || v < 0 {
+			break
+		}
+		parts[n] = v
+		s = s[width:]
+		if n == 0 && v == 0 {
+			return time.Time{}, false
+		}
+	}
+	if parts[0] == 0 || parts[1] < 1 || parts[1] > 12 || parts[2] < 1 || parts[2] > 31 {
+		return time.Time{}, false
+	}
+
+	loc := time.UTC
+	if len(s) > 0 && (s[0] == '+' || s[0] == '-') {
+		tz := strings.ReplaceAll(s[1:], "'", "")
+		hours, err := strconv.Atoi(tz[:min(2, len(tz))])
+		if err == nil {
+			minutes := 0
+			if len(tz) >= 4 {
+				minutes, _ = strconv.Atoi(tz[2:4])
+			}
+			offset := hours*3600 + minutes*60
+			if s[0] == '-' {
+				offset = -offset
+			}
+			loc = time.FixedZone("", offset)
+		}
+	}
+	return time.Date(parts[0], time.Month(parts[1]), parts[2], parts[3], parts[4], parts[5], 0, loc), true
+}
+
+// readOutline reads the bookmarks of a PDF file, flattened in document order
+// and sorted by page. Bookmarks whose destination cannot be resolved to a
+// page are left out.
+func readOutline(r *pdf.Reader, filename string) (outline []OutlineEntry) {
+	defer func() {
+		if err := recover(); err != nil {
+			log.Printf("[PDF OUTLINE ERROR] File: %s | Error: %v", filename, err)
+			outline = nil
+		}
+	}()
+
+	root := r.Trailer().Key("Root")
+	first := root.Key("Outlines").Key("First")
+	if first.Kind() != pdf.Dict {
+		return nil
+	}
+
+	// The library does not expose object identity, but a page dictionary
+	// printed with its references (contents, parent) identifies the page
+	pages := make(map[string]int)
+	for i := 1; i <= r.NumPage(); i++ {
+		if p := r.Page(i); !p.V.IsNull() {
+			key := p.V.String()
+			if _, ok := pages[key]; !ok {
+				pages[key] = i
+			}
+		}
+	}
+
+	var walk func(item pdf.Value, level int)
+	walk = func(item pdf.Value, level int) {
+		for ; item.Kind() == pdf.Dict && len(outline) < maxOutlineEntries; item = item.Key("Next") {
+			title := strings.TrimSpace(item.Key("Title").Text())
+			if page := pages[destPage(root, item).String()]; title != "" && page > 0 {
+				outline = append(outline, OutlineEntry{Title: title, Page: page, Level: level})
+			}
+			walk(item.Key("First"), level+1)
+		}
+	}
+	walk(first, 1)
+
+	sort.SliceStable(outline, func(i, j int) bool { return outline[i].Page < outline[j].Page })
+	return outline
+}
+
+// destPage returns the page object a bookmark points to, following named
+// destinations and GoTo actions. It returns a null value if there is none.
+func destPage(root, item pdf.Value) pdf.Value {
+	dest := item.Key("Dest")
+	if dest.IsNull() {
+		if action := item.Key("A"); action.Key("S").Name() == "GoTo" {
+			dest = action.Key("D")
+		}
+	}
+
+	switch dest.Kind() {
+	case pdf.Name:
+		dest = root.Key("Dests").Key(dest.Name())
+	case pdf.String:
+		name := dest.RawString()
+		dest = lookupNameTree(root.Key("Names").Key("Dests"), name, 0)
+		if dest.IsNull() {
+			dest = root.Key("Dests").Key(name)
+		}
+	}
+	// Named destinations may be wrapped in a dictionary
+	if dest.Kind() == pdf.Dict {
+		dest = dest.Key("D")
+	}
+	if dest.Kind() != pdf.Array {
+		return pdf.Value{}
+	}
+	return dest.Index(0)
+}
+
+// lookupNameTree finds name in a PDF name tree.
+func lookupNameTree(node pdf.Value, name string, depth int) pdf.Value {
+	if node.Kind() != pdf.Dict || depth > 32 {
+		return pdf.Value{}
+	}
+	names := node.Key("Names")
+	for i := 0; i+1 < names.Len(); i += 2 {
+		if names.Index(i).RawString() == name {
+			return names.Index(i + 1)
+		}
+	}
+	kids := node.Key("Kids")
+	for i := 0; i < kids.Len(); i++ {
+		kid := kids.Index(i)
+		if limits := kid.Key("Limits"); limits.Len() == 2 &&
+			(name < limits.Index(0).RawString() || name > limits.Index(1).RawString()) {
+			continue
+		}
+		if v := lookupNameTree(kid, name, depth+1); !v.IsNull() {
+			return v
+		}
+	}
+	return pdf.Value{}
+}
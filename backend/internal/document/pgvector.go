@@ -0,0 +1,324 @@
+package document
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// PgVectorStore is a VectorStore backed by PostgreSQL with the pgvector
+// extension. Each collection is one table; chunk metadata is kept as jsonb
+// with the filename extracted into an indexed column for deletes.
+type PgVectorStore struct {
+	pool  *pgxpool.Pool
+	table string // sanitized identifier
+
+	mu     sync.Mutex
+	exists bool
+}
+
+// NewPgVectorStore connects to the database at dsn and enables the vector
+// extension. The collection table is created on the first upsert, once the
+// embedding size is known.
+func NewPgVectorStore(ctx context.Context, dsn, collection string) (*PgVectorStore, error) {
+	pool, err := pgxpool.New(ctx, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to postgres: %w", err)
+	}
+
+	if _, err := pool.Exec(ctx, "CREATE EXTENSION IF NOT EXISTS vector"); err != nil {
+		pool.Close()
+		return nil, fmt.Errorf("failed to enable pgvector extension: %w", err)
+	}
+
+	s := &PgVectorStore{
+		pool:  pool,
+		table: pgx.Identifier{collection + "_chunks"}.Sanitize(),
+	}
+
+	var regclass *string
+	if err := pool.QueryRow(ctx, "SELECT to_regclass($1)::text", s.table).Scan(&regclass); err != nil {
+		pool.Close()
+		return nil, fmt.Errorf("failed to look up table %s: %w", s.table, err)
+	}
+	s.exists = regclass != nil
+
+	return s, nil
+}
+
+// ensureTable creates the chunk table and its indexes for the given
+// embedding size.
+func (s *PgVectorStore) ensureTable(ctx context.Context, dims int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.exists {
+		return nil
+	}
+
+	name := strings.Trim(s.table, `"`)
+	stmts := []string{
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+			id        text PRIMARY KEY,
+			document  text NOT NULL,
+			embedding vector(%d) NOT NULL,
+			metadata  jsonb NOT NULL DEFAULT '{}',
+			filename  text GENERATED ALWAYS AS (metadata->>'filename') STORED
+		)`, s.table, dims),
+		fmt.Sprintf(`CREATE INDEX IF NOT EXISTS %s ON %s (filename)`,
+			pgx.Identifier{name + "_filename_idx"}.Sanitize(), s.table),
+		fmt.Sprintf(`CREATE INDEX IF NOT EXISTS %s ON %s USING gin (metadata jsonb_path_ops)`,
+			pgx.Identifier{name + "_metadata_idx"}.Sanitize(), s.table),
+		fmt.Sprintf(`CREATE INDEX IF NOT EXISTS %s ON %s USING hnsw (embedding vector_cosine_ops)`,
+			pgx.Identifier{name + "_embedding_idx"}.Sanitize(), s.table),
+	}
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	for _, stmt := range stmts {
+		if _, err := tx.Exec(ctx, stmt); err != nil {
+			return fmt.Errorf("failed to create table %s: %w", s.table, err)
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit schema: %w", err)
+	}
+
+	s.exists = true
+	return nil
+}
+
+func (s *PgVectorStore) tableExists() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.exists
+}
+
+func (s *PgVectorStore) Upsert(ctx context.Context, chunks []Chunk) error {
+	if len(chunks) == 0 {
+		return nil
+	}
+
+	if err := s.ensureTable(ctx, len(chunks[0].Embedding)); err != nil {
+		return err
+	}
+
+	query := fmt.Sprintf(`INSERT INTO %s (id, document, embedding, metadata)
+		VALUES ($1, $2, $3::vector, $4::jsonb)
+		ON CONFLICT (id) DO UPDATE SET
+			document = EXCLUDED.document,
+			embedding = EXCLUDED.embedding,
+			metadata = EXCLUDED.metadata`, s.table)
+
+	batch := &pgx.Batch{}
+	for _, c := range chunks {
+		meta, err := json.Marshal(c.Metadata)
+		if err != nil {
+			return fmt.Errorf("invalid metadata for chunk %s: %w", c.ID, err)
+		}
+		batch.Queue(query, c.ID, c.Text, pgVector(c.Embedding), string(meta))
+	}
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if err := tx.SendBatch(ctx, batch).Close(); err != nil {
+		return fmt.Errorf("pgvector upsert failed: %w", err)
+	}
+	return tx.Commit(ctx)
+}
+
+func (s *PgVectorStore) Query(ctx context.Context, embedding []float32, n int, where Filter) ([]QueryResult, error) {
+	if !s.tableExists() {
+		return nil, nil
+	}
+
+	filter, err := pgFilter(where)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.pool.Query(ctx, fmt.Sprintf(`SELECT id, document, metadata, embedding <=> $1::vector
+		FROM %s
+		WHERE ($2::jsonb IS NULL OR metadata @> $2::jsonb)
+		ORDER BY embedding <=> $1::vector
+		LIMIT $3`, s.table), pgVector(embedding), filter, n)
+	if err != nil {
+		return nil, fmt.Errorf("pgvector query failed: %w", err)
+	}
+	defer rows.Close()
+
+	var results []QueryResult
+	for rows.Next() {
+		var res QueryResult
+		var distance float64
+		if err := rows.Scan(&res.ID, &res.Text, &res.Metadata, &distance); err != nil {
+			return nil, fmt.Errorf("failed to scan result: %w", err)
+		}
+		res.Distance = float32(distance)
+		results = append(results, res)
+	}
+	return results, rows.Err()
+}
+
+func (s *PgVectorStore) Delete(ctx context.Context, where Filter) error {
+	if !s.tableExists() {
+		return nil
+	}
+
+	filter, err := pgFilter(where)
+	if err != nil {
+		return err
+	}
+
+	// Filename-only deletes use the indexed column directly.
+	if filename, ok := where["filename"].(string); ok && len(where) == 1 {
+		_, err = s.pool.Exec(ctx, fmt.Sprintf(`DELETE FROM %s WHERE filename = $1`, s.table), filename)
+	} else {
+		_, err = s.pool.Exec(ctx, fmt.Sprintf(`DELETE FROM %s WHERE ($1::jsonb IS NULL OR metadata @> $1::jsonb)`, s.table), filter)
+	}
+	if err != nil {
+		return fmt.Errorf("pgvector delete failed: %w", err)
+	}
+	return nil
+}
+
+func (s *PgVectorStore) SetMetadata(ctx context.Context, where Filter, values map[string]interface{}) error {
+	if !s.tableExists() {
+		return nil
+	}
+
+	filter, err := pgFilter(where)
+	if err != nil {
+		return err
+	}
+	patch, err := json.Marshal(values)
+	if err != nil {
+		return fmt.Errorf("invalid metadata: %w", err)
+	}
+
+	if _, err := s.pool.Exec(ctx, fmt.Sprintf(`UPDATE %s SET metadata = metadata || $1::jsonb
+		WHERE ($2::jsonb IS NULL OR metadata @> $2::jsonb)`, s.table), string(patch), filter); err != nil {
+		return fmt.Errorf("pgvector update failed: %w", err)
+	}
+	return nil
+}
+
+func (s *PgVectorStore) Count(ctx context.Context) (int, error) {
+	if !s.tableExists() {
+		return 0, nil
+	}
+
+	var count int
+	if err := s.pool.QueryRow(ctx, fmt.Sprintf(`SELECT count(*) FROM %s`, s.table)).Scan(&count); err != nil {
+		return 0, fmt.Errorf("pgvector count failed: %w", err)
+	}
+	return count, nil
+}
+
+func (s *PgVectorStore) ListMetadata(ctx context.Context, where Filter) ([]map[string]interface{}, error) {
+	if !s.tableExists() {
+		return nil, nil
+	}
+
+	filter, err := pgFilter(where)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.pool.Query(ctx, fmt.Sprintf(`SELECT metadata FROM %s
+		WHERE ($1::jsonb IS NULL OR metadata @> $1::jsonb)`, s.table), filter)
+	if err != nil {
+		return nil, fmt.Errorf("pgvector list failed: %w", err)
+	}
+	defer rows.Close()
+
+	var metadatas []map[string]interface{}
+	for rows.Next() {
+		var meta map[string]interface{}
+		if err := rows.Scan(&meta); err != nil {
+			return nil, fmt.Errorf("failed to scan metadata: %w", err)
+		}
+		metadatas = append(metadatas, meta)
+	}
+	return metadatas, rows.Err()
+}
+
+// FileChunkCounts aggregates the chunk counts of the latest version of every
+// file in the database, keyed by document ID.
+func (s *PgVectorStore) FileChunkCounts(ctx context.Context) (map[string]int, error) {
+	counts := make(map[string]int)
+	if !s.tableExists() {
+		return counts, nil
+	}
+
+	rows, err := s.pool.Query(ctx, fmt.Sprintf(`SELECT metadata->>'document_id', count(*) FROM %s
+		WHERE metadata->>'latest' = 'true' AND metadata->>'document_id' IS NOT NULL
+		GROUP BY metadata->>'document_id'`, s.table))
+	if err != nil {
+		return nil, fmt.Errorf("pgvector stats failed: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var documentID string
+		var count int
+		if err := rows.Scan(&documentID, &count); err != nil {
+			return nil, fmt.Errorf("failed to scan stats: %w", err)
+		}
+		counts[documentID] = count
+	}
+	return counts, rows.Err()
+}
+
+func (s *PgVectorStore) DropCollection(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.pool.Exec(ctx, fmt.Sprintf(`DROP TABLE IF EXISTS %s`, s.table)); err != nil {
+		return fmt.Errorf("failed to drop table %s: %w", s.table, err)
+	}
+	s.exists = false
+	return nil
+}
+
+// pgVector formats an embedding as a pgvector text literal, e.g. "[1,2,3]".
+func pgVector(v []float32) string {
+	var b strings.Builder
+	b.WriteByte('[')
+	for i, x := range v {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(strconv.FormatFloat(float64(x), 'f', -1, 32))
+	}
+	b.WriteByte(']')
+	return b.String()
+}
+
+// pgFilter encodes a Filter as a jsonb containment document, or nil for an
+// empty filter.
+func pgFilter(where Filter) (*string, error) {
+	if len(where) == 0 {
+		return nil, nil
+	}
+	data, err := json.Marshal(where)
+	if err != nil {
+		return nil, fmt.Errorf("invalid filter: %w", err)
+	}
+	filter := string(data)
+	return &filter, nil
+}
@@ -0,0 +1,384 @@
+package document
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/akhilmk/gowise/internal/resilient"
+	"github.com/google/uuid"
+)
+
+// qdrantTextKey is the payload field holding the chunk text; every other
+// payload field is chunk metadata.
+const qdrantTextKey = "document"
+
+// qdrantPageSize bounds how many points a single scroll call returns.
+const qdrantPageSize = 1000
+
+type qdrantPoint struct {
+	ID      interface{}            `json:"id"`
+	Vector  []float32              `json:"vector,omitempty"`
+	Payload map[string]interface{} `json:"payload,omitempty"`
+	Score   float32                `json:"score,omitempty"`
+}
+
+type qdrantFilter struct {
+	Must []qdrantCondition `json:"must"`
+}
+
+type qdrantCondition struct {
+	Key   string                 `json:"key"`
+	Match map[string]interface{} `json:"match"`
+}
+
+type qdrantSearchRequest struct {
+	Vector      []float32     `json:"vector"`
+	Limit       int           `json:"limit"`
+	Filter      *qdrantFilter `json:"filter,omitempty"`
+	WithPayload bool          `json:"with_payload"`
+}
+
+type qdrantScrollRequest struct {
+	Limit       int                    `json:"limit"`
+	Offset      interface{}            `json:"offset,omitempty"`
+	Filter      *qdrantFilter          `json:"filter,omitempty"`
+	WithPayload map[string]interface{} `json:"with_payload"`
+	WithVector  bool                   `json:"with_vector"`
+}
+
+type qdrantScrollResult struct {
+	Points         []qdrantPoint `json:"points"`
+	NextPageOffset interface{}   `json:"next_page_offset"`
+}
+
+// QdrantStore is a VectorStore backed by the Qdrant REST API. Chunk metadata
+// is stored as point payload so filename filters map onto payload matches.
+type QdrantStore struct {
+	baseURL    string
+	apiKey     string
+	collection string
+	client     *resilient.Client
+
+	mu      sync.Mutex
+	ensured bool
+}
+
+// NewQdrantStore creates a store for the named collection on the Qdrant
+// server at baseURL, sending requests through client. The collection is
+// created on the first upsert, once the embedding size is known.
+func NewQdrantStore(baseURL, apiKey, collection string, client *resilient.Client) *QdrantStore {
+	return &QdrantStore{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		apiKey:     apiKey,
+		collection: collection,
+		client:     client,
+	}
+}
+
+func (s *QdrantStore) Upsert(ctx context.Context, chunks []Chunk) error {
+	if len(chunks) == 0 {
+		return nil
+	}
+
+	if err := s.ensureCollection(ctx, len(chunks[0].Embedding)); err != nil {
+		return err
+	}
+
+	points := make([]qdrantPoint, 0, len(chunks))
+	for _, c := range chunks {
+		payload := copyMetadata(c.Metadata)
+		payload[qdrantTextKey] = c.Text
+		points = append(points, qdrantPoint{
+			ID:      qdrantPointID(c.ID),
+			Vector:  c.Embedding,
+			Payload: payload,
+		})
+	}
+
+	status, body, err := s.do(ctx, http.MethodPut, "/points?wait=true", map[string]interface{}{"points": points}, nil)
+	if err != nil {
+		return err
+	}
+	if status >= 300 {
+		return fmt.Errorf("qdrant upsert returned status %d: %s", status, body)
+	}
+	return nil
+}
+
+func (s *QdrantStore) Query(ctx context.Context, embedding []float32, n int, where Filter) ([]QueryResult, error) {
+	var hits []qdrantPoint
+	status, body, err := s.do(ctx, http.MethodPost, "/points/search", qdrantSearchRequest{
+		Vector:      embedding,
+		Limit:       n,
+		Filter:      qdrantWhere(where),
+		WithPayload: true,
+	}, &hits)
+	if err != nil {
+		return nil, err
+	}
+	if status == http.StatusNotFound {
+		return nil, nil
+	}
+	if status >= 300 {
+		return nil, fmt.Errorf("qdrant search returned status %d: %s", status, body)
+	}
+
+	results := make([]QueryResult, 0, len(hits))
+	for _, hit := range hits {
+		text, _ := hit.Payload[qdrantTextKey].(string)
+		delete(hit.Payload, qdrantTextKey)
+		results = append(results, QueryResult{
+			ID:       fmt.Sprint(hit.ID),
+			Text:     text,
+			Metadata: hit.Payload,
+			// Qdrant reports cosine similarity; convert to Chroma-style distance
+			Distance: 1 - hit.Score,
+		})
+	}
+	return results, nil
+}
+
+func (s *QdrantStore) Delete(ctx context.Context, where Filter) error {
+	filter := qdrantWhere(where)
+	if filter == nil {
+		filter = &qdrantFilter{Must: []qdrantCondition{}}
+	}
+
+	status, body, err := s.do(ctx, http.MethodPost, "/points/delete?wait=true", map[string]interface{}{"filter": filter}, nil)
+	if err != nil {
+		return err
+	}
+	if status == http.StatusNotFound {
+		return nil
+	}
+	if status >= 300 {
+		return fmt.Errorf("qdrant delete returned status %d: %s", status, body)
+	}
+	return nil
+}
+
+func (s *QdrantStore) SetMetadata(ctx context.Context, where Filter, values map[string]interface{}) error {
+	filter := qdrantWhere(where)
+	if filter == nil {
+		filter = &qdrantFilter{Must: []qdrantCondition{}}
+	}
+
+	status, body, err := s.do(ctx, http.MethodPost, "/points/payload?wait=true", map[string]interface{}{
+		"payload": values,
+		"filter":  filter,
+	}, nil)
+	if err != nil {
+		return err
+	}
+	if status == http.StatusNotFound {
+		return nil
+	}
+	if status >= 300 {
+		return fmt.Errorf("qdrant set payload returned status %d: %s", status, body)
+	}
+	return nil
+}
+
+func (s *QdrantStore) Count(ctx context.Context) (int, error) {
+	var res struct {
+		Count int `json:"count"`
+	}
+	status, body, err := s.do(ctx, http.MethodPost, "/points/count", map[string]bool{"exact": true}, &res)
+	if err != nil {
+		return 0, err
+	}
+	if status == http.StatusNotFound {
+		return 0, nil
+	}
+	if status >= 300 {
+		return 0, fmt.Errorf("qdrant count returned status %d: %s", status, body)
+	}
+	return res.Count, nil
+}
+
+func (s *QdrantStore) ListMetadata(ctx context.Context, where Filter) ([]map[string]interface{}, error) {
+	var metadatas []map[string]interface{}
+	var offset interface{}
+	for {
+		var page qdrantScrollResult
+		status, body, err := s.do(ctx, http.MethodPost, "/points/scroll", qdrantScrollRequest{
+			Limit:       qdrantPageSize,
+			Offset:      offset,
+			Filter:      qdrantWhere(where),
+			WithPayload: map[string]interface{}{"exclude": []string{qdrantTextKey}},
+			WithVector:  false,
+		}, &page)
+		if err != nil {
+			return nil, err
+		}
+		if status == http.StatusNotFound {
+			return nil, nil
+		}
+		if status >= 300 {
+			return nil, fmt.Errorf("qdrant scroll returned status %d: %s", status, body)
+		}
+
+		for _, p := range page.Points {
+			metadatas = append(metadatas, p.Payload)
+		}
+		if page.NextPageOffset == nil {
+			break
+		}
+		offset = page.NextPageOffset
+	}
+	return metadatas, nil
+}
+
+func (s *QdrantStore) DropCollection(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	status, body, err := s.do(ctx, http.MethodDelete, "", nil, nil)
+	if err != nil {
+		return fmt.Errorf("failed to delete collection: %w", err)
+	}
+	if status >= 300 && status != http.StatusNotFound {
+		return fmt.Errorf("qdrant delete collection returned status %d: %s", status, body)
+	}
+	s.ensured = false
+	return nil
+}
+
+// qdrantIndexes are the payload fields filters use, with their index types:
+// deletes match filename, document_id and job_id, version changes match
+// document_id and job_id, and search matches latest.
+var qdrantIndexes = []struct{ field, schema string }{
+	{"filename", "keyword"},
+	{"document_id", "keyword"},
+	{"job_id", "keyword"},
+	{"latest", "bool"},
+}
+
+// ensureCollection creates the collection with a cosine index of the given
+// size, plus the payload indexes in qdrantIndexes. A collection created
+// before one of them existed gets it here too.
+func (s *QdrantStore) ensureCollection(ctx context.Context, dims int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.ensured {
+		return nil
+	}
+
+	status, body, err := s.do(ctx, http.MethodGet, "", nil, nil)
+	if err != nil {
+		return err
+	}
+	switch {
+	case status == http.StatusNotFound:
+		status, body, err = s.do(ctx, http.MethodPut, "", map[string]interface{}{
+			"vectors": map[string]interface{}{"size": dims, "distance": "Cosine"},
+		}, nil)
+		if err != nil {
+			return err
+		}
+		if status >= 300 {
+			return fmt.Errorf("qdrant create collection returned status %d: %s", status, body)
+		}
+	case status != http.StatusOK:
+		return fmt.Errorf("qdrant get collection returned status %d: %s", status, body)
+	}
+
+	// Creating an index that exists already is a no-op
+	for _, index := range qdrantIndexes {
+		status, body, err = s.do(ctx, http.MethodPut, "/index?wait=true", map[string]string{
+			"field_name":   index.field,
+			"field_schema": index.schema,
+		}, nil)
+		if err != nil {
+			return err
+		}
+		if status >= 300 {
+			return fmt.Errorf("qdrant create payload index on %s returned status %d: %s", index.field, status, body)
+		}
+	}
+
+	s.ensured = true
+	return nil
+}
+
+// do sends a request to path under the collection URL. On success the
+// "result" field of the response is decoded into out (if non-nil); the raw
+// body is returned for error reporting.
+func (s *QdrantStore) do(ctx context.Context, method, path string, payload, out interface{}) (int, string, error) {
+	var reqBody io.Reader
+	if payload != nil {
+		data, err := json.Marshal(payload)
+		if err != nil {
+			return 0, "", fmt.Errorf("failed to encode request: %w", err)
+		}
+		reqBody = bytes.NewReader(data)
+	}
+
+	u := fmt.Sprintf("%s/collections/%s%s", s.baseURL, url.PathEscape(s.collection), path)
+	req, err := http.NewRequestWithContext(ctx, method, u, reqBody)
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to create request: %w", err)
+	}
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if s.apiKey != "" {
+		req.Header.Set("api-key", s.apiKey)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, "", fmt.Errorf("http %s to %s failed: %w", method, u, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return resp.StatusCode, "", fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if resp.StatusCode < 300 && out != nil {
+		var envelope struct {
+			Result json.RawMessage `json:"result"`
+		}
+		if err := json.Unmarshal(body, &envelope); err != nil {
+			return resp.StatusCode, string(body), fmt.Errorf("failed to decode response: %w", err)
+		}
+		if err := json.Unmarshal(envelope.Result, out); err != nil {
+			return resp.StatusCode, string(body), fmt.Errorf("failed to decode result: %w", err)
+		}
+	}
+
+	return resp.StatusCode, string(body), nil
+}
+
+// qdrantPointID maps a chunk ID onto a Qdrant point ID, which must be a UUID
+// or an unsigned integer. Other IDs are hashed into a stable UUID.
+func qdrantPointID(id string) string {
+	if parsed, err := uuid.Parse(id); err == nil {
+		return parsed.String()
+	}
+	return uuid.NewSHA1(uuid.NameSpaceOID, []byte(id)).String()
+}
+
+func qdrantWhere(where Filter) *qdrantFilter {
+	if len(where) == 0 {
+		return nil
+	}
+	filter := &qdrantFilter{Must: make([]qdrantCondition, 0, len(where))}
+	for k, v := range where {
+		filter.Must = append(filter.Must, qdrantCondition{
+			Key:   k,
+			Match: map[string]interface{}{"value": v},
+		})
+	}
+	return filter
+}
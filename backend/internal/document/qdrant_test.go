@@ -0,0 +1,391 @@
+package document
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/akhilmk/gowise/internal/resilient"
+)
+
+// fakeQdrant is an in-memory Qdrant serving the REST calls QdrantStore makes
+// for a single collection.
+type fakeQdrant struct {
+	t          *testing.T
+	collection string
+
+	mu      sync.Mutex
+	exists  bool
+	dims    int
+	indexed []string
+	points  map[string]qdrantPoint
+	apiKeys []string
+}
+
+func newFakeQdrant(t *testing.T, collection string) (*fakeQdrant, *QdrantStore) {
+	t.Helper()
+	f := &fakeQdrant{t: t, collection: collection, points: make(map[string]qdrantPoint)}
+	srv := httptest.NewServer(f)
+	t.Cleanup(srv.Close)
+
+	cfg := resilient.DefaultConfig()
+	cfg.MaxAttempts = 1
+	return f, NewQdrantStore(srv.URL+"/", "secret", collection, resilient.New("qdrant", cfg))
+}
+
+func (f *fakeQdrant) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.apiKeys = append(f.apiKeys, r.Header.Get("api-key"))
+	path, ok := strings.CutPrefix(r.URL.Path, "/collections/"+f.collection)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	var body struct {
+		Vectors struct {
+			Size int `json:"size"`
+		} `json:"vectors"`
+		FieldName string                 `json:"field_name"`
+		Points    []qdrantPoint          `json:"points"`
+		Vector    []float32              `json:"vector"`
+		Limit     int                    `json:"limit"`
+		Offset    *float64               `json:"offset"`
+		Filter    *qdrantFilter          `json:"filter"`
+		Payload   map[string]interface{} `json:"payload"`
+	}
+	if r.Body != nil && r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			f.t.Errorf("%s %s: invalid body: %v", r.Method, r.URL, err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	route := r.Method + " " + path
+	if !f.exists && route != "GET " && route != "PUT " && route != "DELETE " {
+		http.Error(w, `{"status":{"error":"Not found: Collection doesn't exist!"}}`, http.StatusNotFound)
+		return
+	}
+
+	var result interface{} = true
+	switch route {
+	case "GET ":
+		if !f.exists {
+			http.Error(w, `{"status":{"error":"Not found"}}`, http.StatusNotFound)
+			return
+		}
+	case "PUT ":
+		f.exists, f.dims = true, body.Vectors.Size
+	case "DELETE ":
+		if !f.exists {
+			http.Error(w, `{"status":{"error":"Not found"}}`, http.StatusNotFound)
+			return
+		}
+		f.exists, f.points = false, make(map[string]qdrantPoint)
+	case "PUT /index":
+		f.indexed = append(f.indexed, body.FieldName)
+	case "PUT /points":
+		for _, p := range body.Points {
+			if len(p.Vector) != f.dims {
+				http.Error(w, `{"status":{"error":"wrong vector size"}}`, http.StatusBadRequest)
+				return
+			}
+			f.points[p.ID.(string)] = p
+		}
+	case "POST /points/search":
+		var hits []qdrantPoint
+		for _, p := range f.matching(body.Filter) {
+			p.Score = 1 - cosineDistance(body.Vector, vectorNorm(body.Vector), p.Vector, vectorNorm(p.Vector))
+			p.Vector = nil
+			hits = append(hits, p)
+		}
+		sort.SliceStable(hits, func(i, j int) bool { return hits[i].Score > hits[j].Score })
+		if len(hits) > body.Limit {
+			hits = hits[:body.Limit]
+		}
+		result = hits
+	case "POST /points/delete":
+		for _, p := range f.matching(body.Filter) {
+			delete(f.points, p.ID.(string))
+		}
+	case "POST /points/payload":
+		for _, p := range f.matching(body.Filter) {
+			for k, v := range body.Payload {
+				p.Payload[k] = v
+			}
+		}
+	case "POST /points/count":
+		result = map[string]int{"count": len(f.points)}
+	case "POST /points/scroll":
+		// Offsets are positions in ID order, which is enough for paging
+		points := f.matching(body.Filter)
+		start := 0
+		if body.Offset != nil {
+			start = int(*body.Offset)
+		}
+		end := min(start+body.Limit, len(points))
+		page := qdrantScrollResult{Points: points[start:end]}
+		if end < len(points) {
+			page.NextPageOffset = end
+		}
+		for i := range page.Points {
+			page.Points[i].Vector = nil
+			page.Points[i].Payload = copyMetadata(page.Points[i].Payload)
+			delete(page.Points[i].Payload, qdrantTextKey)
+		}
+		result = page
+	default:
+		f.t.Errorf("unexpected request %s %s", r.Method, r.URL)
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"result": result, "status": "ok"})
+}
+
+// matching returns the points matching every condition of filter, in ID
+// order. Callers must hold f.mu.
+func (f *fakeQdrant) matching(filter *qdrantFilter) []qdrantPoint {
+	var points []qdrantPoint
+	for _, p := range f.points {
+		ok := true
+		if filter != nil {
+			for _, c := range filter.Must {
+				if !metadataValueEqual(p.Payload[c.Key], c.Match["value"]) {
+					ok = false
+				}
+			}
+		}
+		if ok {
+			points = append(points, p)
+		}
+	}
+	sort.Slice(points, func(i, j int) bool { return points[i].ID.(string) < points[j].ID.(string) })
+	return points
+}
+
+func testChunks() []Chunk {
+	return []Chunk{
+		{ID: "a", Text: "alpha", Embedding: []float32{1, 0}, Metadata: map[string]interface{}{"document_id": "d1", "version": 1, "latest": true}},
+		{ID: "b", Text: "beta", Embedding: []float32{0, 1}, Metadata: map[string]interface{}{"document_id": "d1", "version": 1, "latest": true}},
+		{ID: "c", Text: "gamma", Embedding: []float32{1, 1}, Metadata: map[string]interface{}{"document_id": "d2", "version": 2, "latest": false}},
+	}
+}
+
+func TestQdrantUpsert(t *testing.T) {
+	f, store := newFakeQdrant(t, "docs")
+	ctx := context.Background()
+
+	if err := store.Upsert(ctx, testChunks()); err != nil {
+		t.Fatalf("Upsert: %v", err)
+	}
+	if !f.exists || f.dims != 2 {
+		t.Fatalf("collection exists=%v dims=%d, want created with 2 dimensions", f.exists, f.dims)
+	}
+	if want := []string{"filename", "document_id", "job_id", "latest"}; !reflect.DeepEqual(f.indexed, want) {
+		t.Errorf("payload indexes = %v, want %v", f.indexed, want)
+	}
+	if len(f.points) != 3 {
+		t.Fatalf("stored %d points, want 3", len(f.points))
+	}
+	p, ok := f.points[qdrantPointID("a")]
+	if !ok {
+		t.Fatalf("point for chunk a not stored under %s", qdrantPointID("a"))
+	}
+	if p.Payload[qdrantTextKey] != "alpha" || p.Payload["document_id"] != "d1" {
+		t.Errorf("payload = %v, want text and metadata", p.Payload)
+	}
+	for _, key := range f.apiKeys {
+		if key != "secret" {
+			t.Errorf("api-key header = %q, want secret", key)
+		}
+	}
+
+	// Upserting the same IDs again replaces the points and does not
+	// recreate the collection
+	requests := len(f.apiKeys)
+	if err := store.Upsert(ctx, testChunks()[:1]); err != nil {
+		t.Fatalf("second Upsert: %v", err)
+	}
+	if len(f.points) != 3 || len(f.apiKeys) != requests+1 {
+		t.Errorf("second upsert: %d points after %d requests, want 3 points after 1 request", len(f.points), len(f.apiKeys)-requests)
+	}
+}
+
+func TestQdrantQueryFilter(t *testing.T) {
+	_, store := newFakeQdrant(t, "docs")
+	ctx := context.Background()
+	if err := store.Upsert(ctx, testChunks()); err != nil {
+		t.Fatalf("Upsert: %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		where Filter
+		n     int
+		want  []string
+	}{
+		{"no filter", nil, 10, []string{"alpha", "gamma", "beta"}},
+		{"latest", Filter{"latest": true}, 10, []string{"alpha", "beta"}},
+		{"document and version", Filter{"document_id": "d2", "version": 2}, 10, []string{"gamma"}},
+		{"no match", Filter{"document_id": "d3"}, 10, nil},
+		{"limit", Filter{"latest": true}, 1, []string{"alpha"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results, err := store.Query(ctx, []float32{1, 0}, tt.n, tt.where)
+			if err != nil {
+				t.Fatalf("Query: %v", err)
+			}
+			var texts []string
+			for _, r := range results {
+				texts = append(texts, r.Text)
+				if _, ok := r.Metadata[qdrantTextKey]; ok {
+					t.Errorf("metadata of %s still holds the text", r.ID)
+				}
+				if r.Text == "alpha" && (r.Distance < -1e-6 || r.Distance > 1e-6) {
+					t.Errorf("distance of an identical vector = %v, want 0", r.Distance)
+				}
+				if r.Text == "beta" && (r.Distance < 1-1e-6 || r.Distance > 1+1e-6) {
+					t.Errorf("distance of an orthogonal vector = %v, want 1", r.Distance)
+				}
+			}
+			if strings.Join(texts, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("got %v, want %v", texts, tt.want)
+			}
+		})
+	}
+}
+
+func TestQdrantDelete(t *testing.T) {
+	f, store := newFakeQdrant(t, "docs")
+	ctx := context.Background()
+	if err := store.Upsert(ctx, testChunks()); err != nil {
+		t.Fatalf("Upsert: %v", err)
+	}
+
+	if err := store.Delete(ctx, Filter{"document_id": "d1"}); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if n, _ := store.Count(ctx); n != 1 {
+		t.Fatalf("Count after delete = %d, want 1", n)
+	}
+	if _, ok := f.points[qdrantPointID("c")]; !ok {
+		t.Error("delete removed a point of another document")
+	}
+
+	// An empty filter matches everything
+	if err := store.Delete(ctx, nil); err != nil {
+		t.Fatalf("Delete all: %v", err)
+	}
+	if n, _ := store.Count(ctx); n != 0 {
+		t.Errorf("Count after deleting all = %d, want 0", n)
+	}
+}
+
+func TestQdrantSetMetadata(t *testing.T) {
+	_, store := newFakeQdrant(t, "docs")
+	ctx := context.Background()
+	if err := store.Upsert(ctx, testChunks()); err != nil {
+		t.Fatalf("Upsert: %v", err)
+	}
+
+	if err := store.SetMetadata(ctx, Filter{"document_id": "d2"}, map[string]interface{}{"latest": true}); err != nil {
+		t.Fatalf("SetMetadata: %v", err)
+	}
+	latest, err := store.ListMetadata(ctx, Filter{"latest": true})
+	if err != nil {
+		t.Fatalf("ListMetadata: %v", err)
+	}
+	if len(latest) != 3 {
+		t.Fatalf("%d chunks are latest, want 3", len(latest))
+	}
+	for _, meta := range latest {
+		if meta["document_id"] == "d2" && meta["version"] != float64(2) {
+			t.Errorf("SetMetadata changed other fields: %v", meta)
+		}
+		if _, ok := meta[qdrantTextKey]; ok {
+			t.Errorf("ListMetadata returned the text: %v", meta)
+		}
+	}
+}
+
+func TestQdrantListMetadataPages(t *testing.T) {
+	f, store := newFakeQdrant(t, "docs")
+	ctx := context.Background()
+
+	chunks := make([]Chunk, qdrantPageSize+5)
+	for i := range chunks {
+		chunks[i] = Chunk{ID: qdrantPointID(strings.Repeat("x", i+1)), Embedding: []float32{1, 0}, Metadata: map[string]interface{}{"n": i}}
+	}
+	if err := store.Upsert(ctx, chunks); err != nil {
+		t.Fatalf("Upsert: %v", err)
+	}
+	requests := len(f.apiKeys)
+	metas, err := store.ListMetadata(ctx, nil)
+	if err != nil {
+		t.Fatalf("ListMetadata: %v", err)
+	}
+	if len(metas) != len(chunks) {
+		t.Errorf("listed %d chunks, want %d", len(metas), len(chunks))
+	}
+	if pages := len(f.apiKeys) - requests; pages != 2 {
+		t.Errorf("listed in %d scroll calls, want 2", pages)
+	}
+}
+
+func TestQdrantMissingCollection(t *testing.T) {
+	_, store := newFakeQdrant(t, "docs")
+	ctx := context.Background()
+
+	if results, err := store.Query(ctx, []float32{1, 0}, 5, Filter{"latest": true}); err != nil || len(results) != 0 {
+		t.Errorf("Query = %v, %v; want no results and no error", results, err)
+	}
+	if err := store.Delete(ctx, Filter{"document_id": "d1"}); err != nil {
+		t.Errorf("Delete: %v", err)
+	}
+	if err := store.SetMetadata(ctx, Filter{"document_id": "d1"}, map[string]interface{}{"latest": false}); err != nil {
+		t.Errorf("SetMetadata: %v", err)
+	}
+	if n, err := store.Count(ctx); err != nil || n != 0 {
+		t.Errorf("Count = %d, %v; want 0 and no error", n, err)
+	}
+	if metas, err := store.ListMetadata(ctx, nil); err != nil || len(metas) != 0 {
+		t.Errorf("ListMetadata = %v, %v; want none and no error", metas, err)
+	}
+	if err := store.DropCollection(ctx); err != nil {
+		t.Errorf("DropCollection: %v", err)
+	}
+}
+
+func TestQdrantDropCollection(t *testing.T) {
+	f, store := newFakeQdrant(t, "docs")
+	ctx := context.Background()
+	if err := store.Upsert(ctx, testChunks()); err != nil {
+		t.Fatalf("Upsert: %v", err)
+	}
+	if err := store.DropCollection(ctx); err != nil {
+		t.Fatalf("DropCollection: %v", err)
+	}
+	if f.exists {
+		t.Fatal("collection still exists")
+	}
+
+	// The next upsert creates the collection again
+	if err := store.Upsert(ctx, testChunks()); err != nil {
+		t.Fatalf("Upsert after drop: %v", err)
+	}
+	if !f.exists || len(f.points) != 3 {
+		t.Errorf("after drop and upsert: exists=%v points=%d, want recreated with 3", f.exists, len(f.points))
+	}
+}
@@ -0,0 +1,255 @@
+package document
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/akhilmk/gowise/internal/resilient"
+)
+
+// emptyPayloadHash is the SHA-256 of an empty request body.
+var emptyPayloadHash = hex.EncodeToString(sha256.New().Sum(nil))
+
+// S3BlobStore keeps blobs in a bucket of an S3-compatible object store such
+// as AWS S3 or MinIO. Requests use path-style URLs and AWS Signature
+// Version 4. The bucket is created on first use if it does not exist.
+type S3BlobStore struct {
+	endpoint  *url.URL
+	region    string
+	bucket    string
+	accessKey string
+	secretKey string
+	client    *resilient.Client
+
+	bucketReady atomic.Bool
+}
+
+func NewS3BlobStore(endpoint, region, bucket, accessKey, secretKey string, client *resilient.Client) (*S3BlobStore, error) {
+	u, err := url.Parse(strings.TrimSuffix(endpoint, "/"))
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("invalid S3 endpoint %q", endpoint)
+	}
+	if bucket == "" {
+		return nil, fmt.Errorf("S3 bucket name is required")
+	}
+	return &S3BlobStore{
+		endpoint:  u,
+		region:    region,
+		bucket:    bucket,
+		accessKey: accessKey,
+		secretKey: secretKey,
+		client:    client,
+	}, nil
+}
+
+func (s *S3BlobStore) objectURL(key string) *url.URL {
+	u := *s.endpoint
+	u.Path = u.Path + "/" + s.bucket
+	if key != "" {
+		u.Path += "/" + key
+	}
+	return &u
+}
+
+// do signs and sends a request. payloadHash is the hex SHA-256 of body.
+func (s *S3BlobStore) do(ctx context.Context, method string, u *url.URL, body func() (io.ReadCloser, error), size int64, payloadHash string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		rc, err := body()
+		if err != nil {
+			return nil, err
+		}
+		req.Body = rc
+		req.GetBody = body
+		req.ContentLength = size
+	}
+	s.sign(req, payloadHash, time.Now().UTC())
+	return s.client.Do(req)
+}
+
+// sign adds AWS Signature Version 4 headers to req.
+func (s *S3BlobStore) sign(req *http.Request, payloadHash string, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	const signedHeaders = "host;x-amz-content-sha256;x-amz-date"
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		canonicalQuery(req.URL.RawQuery),
+		"host:" + req.URL.Host + "\n" +
+			"x-amz-content-sha256:" + payloadHash + "\n" +
+			"x-amz-date:" + amzDate + "\n",
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + s.region + "/s3/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+s.secretKey), date)
+	key = hmacSHA256(key, s.region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.accessKey, scope, signedHeaders, signature))
+}
+
+// canonicalQuery encodes a query string the way Signature Version 4 signs
+// it: parameters sorted by name and value, each with an "=" even when its
+// value is empty, and spaces escaped as %20.
+func canonicalQuery(rawQuery string) string {
+	values, _ := url.ParseQuery(rawQuery)
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	escape := func(s string) string { return strings.ReplaceAll(url.QueryEscape(s), "+", "%20") }
+	var params []string
+	for _, name := range names {
+		vs := values[name]
+		sort.Strings(vs)
+		for _, v := range vs {
+			params = append(params, escape(name)+"="+escape(v))
+		}
+	}
+	return strings.Join(params, "&")
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// ensureBucket creates the bucket unless it is known to exist.
+func (s *S3BlobStore) ensureBucket(ctx context.Context) error {
+	if s.bucketReady.Load() {
+		return nil
+	}
+
+	resp, err := s.do(ctx, http.MethodHead, s.objectURL(""), nil, 0, emptyPayloadHash)
+	if err != nil {
+		return fmt.Errorf("failed to check bucket %s: %w", s.bucket, err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		resp, err = s.do(ctx, http.MethodPut, s.objectURL(""), nil, 0, emptyPayloadHash)
+		if err != nil {
+			return fmt.Errorf("failed to create bucket %s: %w", s.bucket, err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		// Another instance may have created it in the meantime
+		if resp.StatusCode != http.StatusOK && !bytes.Contains(body, []byte("BucketAlreadyOwnedByYou")) {
+			return fmt.Errorf("failed to create bucket %s: status %d: %s", s.bucket, resp.StatusCode, body)
+		}
+	} else if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to check bucket %s: status %d", s.bucket, resp.StatusCode)
+	}
+
+	s.bucketReady.Store(true)
+	return nil
+}
+
+func (s *S3BlobStore) Put(ctx context.Context, key, path string) error {
+	if err := validBlobKey(key); err != nil {
+		return err
+	}
+	if err := s.ensureBucket(ctx); err != nil {
+		return err
+	}
+
+	size, payloadHash, err := fileSizeAndHash(path)
+	if err != nil {
+		return err
+	}
+	open := func() (io.ReadCloser, error) { return os.Open(path) }
+
+	resp, err := s.do(ctx, http.MethodPut, s.objectURL(key), open, size, payloadHash)
+	if err != nil {
+		return fmt.Errorf("s3 upload failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("s3 upload returned status %d: %s", resp.StatusCode, body)
+	}
+	return nil
+}
+
+func (s *S3BlobStore) Get(ctx context.Context, key string) (io.ReadCloser, int64, error) {
+	if err := validBlobKey(key); err != nil {
+		return nil, 0, err
+	}
+	resp, err := s.do(ctx, http.MethodGet, s.objectURL(key), nil, 0, emptyPayloadHash)
+	if err != nil {
+		return nil, 0, fmt.Errorf("s3 download failed: %w", err)
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, 0, errBlobNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		return nil, 0, fmt.Errorf("s3 download returned status %d: %s", resp.StatusCode, body)
+	}
+	return resp.Body, resp.ContentLength, nil
+}
+
+func (s *S3BlobStore) Delete(ctx context.Context, key string) error {
+	if err := validBlobKey(key); err != nil {
+		return err
+	}
+	resp, err := s.do(ctx, http.MethodDelete, s.objectURL(key), nil, 0, emptyPayloadHash)
+	if err != nil {
+		return fmt.Errorf("s3 delete failed: %w", err)
+	}
+	defer resp.Body.Close()
+	// S3 answers 204 whether or not the object existed
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNotFound {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("s3 delete returned status %d: %s", resp.StatusCode, body)
+	}
+	return nil
+}
+
+// fileSizeAndHash returns the size and hex SHA-256 of the file at path, which
+// signed uploads need up front.
+func fileSizeAndHash(path string) (int64, string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, "", err
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(hash, f)
+	if err != nil {
+		return 0, "", err
+	}
+	return size, hex.EncodeToString(hash.Sum(nil)), nil
+}
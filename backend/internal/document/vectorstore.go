@@ -0,0 +1,79 @@
+package document
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/akhilmk/gowise/internal/resilient"
+)
+
+// Vector store backends selectable via VECTOR_STORE.
+const (
+	StoreChroma   = "chroma"
+	StoreLocal    = "local"
+	StoreQdrant   = "qdrant"
+	StorePgVector = "pgvector"
+)
+
+// Chunk is a piece of document text together with its embedding and metadata.
+type Chunk struct {
+	ID        string
+	Text      string
+	Embedding []float32
+	Metadata  map[string]interface{}
+}
+
+// Filter selects records whose metadata equals every key/value pair.
+// An empty filter matches everything.
+type Filter map[string]interface{}
+
+// QueryResult is a single nearest-neighbour hit. Lower distance is closer.
+type QueryResult struct {
+	ID       string
+	Text     string
+	Metadata map[string]interface{}
+	Distance float32
+}
+
+// VectorStore persists chunk embeddings and answers similarity queries for a
+// single collection.
+type VectorStore interface {
+	// Upsert inserts chunks, replacing any existing records with the same ID.
+	Upsert(ctx context.Context, chunks []Chunk) error
+	// Query returns the n nearest chunks to embedding that match where.
+	Query(ctx context.Context, embedding []float32, n int, where Filter) ([]QueryResult, error)
+	// Delete removes every chunk matching where.
+	Delete(ctx context.Context, where Filter) error
+	// SetMetadata sets the given metadata fields on every chunk matching
+	// where, leaving their other fields unchanged.
+	SetMetadata(ctx context.Context, where Filter, values map[string]interface{}) error
+	// Count returns the number of chunks in the collection.
+	Count(ctx context.Context) (int, error)
+	// ListMetadata returns the metadata of every chunk matching where.
+	ListMetadata(ctx context.Context, where Filter) ([]map[string]interface{}, error)
+	// DropCollection deletes the collection and all of its chunks.
+	DropCollection(ctx context.Context) error
+}
+
+// FileCounter is implemented by stores that can count the chunks of the
+// latest version of every file themselves, keyed by document ID, instead of
+// listing every chunk's metadata.
+type FileCounter interface {
+	FileChunkCounts(ctx context.Context) (map[string]int, error)
+}
+
+// newVectorStore creates the VectorStore selected by cfg.VectorStore.
+func newVectorStore(cfg Config) (VectorStore, error) {
+	switch cfg.VectorStore {
+	case StoreChroma:
+		return NewChromaStore(cfg.ChromaURL, cfg.Collection, resilient.New("chroma", cfg.HTTP)), nil
+	case StoreLocal:
+		return NewLocalStore(cfg.LocalStoreDir, cfg.Collection)
+	case StoreQdrant:
+		return NewQdrantStore(cfg.QdrantURL, cfg.QdrantAPIKey, cfg.Collection, resilient.New("qdrant", cfg.HTTP)), nil
+	case StorePgVector:
+		return NewPgVectorStore(context.Background(), cfg.PgVectorDSN, cfg.Collection)
+	default:
+		return nil, fmt.Errorf("unknown vector store %q", cfg.VectorStore)
+	}
+}
@@ -0,0 +1,441 @@
+package document
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// migrateVersions tags the chunks stored before uploads were versioned as
+// version 1 of their file, so search keeps finding them. Earlier uploads of
+// the same filename that were kept side by side become that one version.
+func (h *Handler) migrateVersions(ctx context.Context) error {
+	if h.documents.migrated() {
+		return nil
+	}
+
+	metadatas, err := h.store.ListMetadata(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to list stored chunks: %w", err)
+	}
+
+	legacy := make(map[string]*Document)
+	for _, meta := range metadatas {
+		filename, _ := meta["filename"].(string)
+		if _, ok := meta["version"]; ok || filename == "" {
+			continue
+		}
+		v, ok := legacy[filename]
+		if !ok {
+			v = &Document{ID: uuid.NewString(), FileID: uuid.NewString(), Filename: filename, Version: 1}
+			v.JobID, _ = meta["job_id"].(string)
+			v.ContentHash, _ = meta["content_hash"].(string)
+			legacy[filename] = v
+		}
+		v.Chunks++
+		if s, ok := meta["uploaded_at"].(string); ok {
+			if t, err := time.Parse(time.RFC3339, s); err == nil && (v.UploadedAt.IsZero() || t.Before(v.UploadedAt)) {
+				v.UploadedAt = t
+			}
+		}
+	}
+
+	for filename, v := range legacy {
+		if err := h.store.SetMetadata(ctx, Filter{"filename": filename}, map[string]interface{}{"version": 1, "latest": true, "document_id": v.ID}); err != nil {
+			return fmt.Errorf("failed to tag %s as version 1: %w", filename, err)
+		}
+		if err := h.documents.add(*v); err != nil {
+			return err
+		}
+		log.Printf("[VERSION MIGRATE] File: %s | Tagged %d chunks as version 1", filename, v.Chunks)
+	}
+	return h.documents.setMigrated()
+}
+
+// reserveVersion assigns the job the next version number of its file. A
+// resumed job keeps the number it was given before the restart.
+func (h *Handler) reserveVersion(job *Job) error {
+	fileID := job.FileID
+	if fileID == "" {
+		// Queued before uploads had file IDs, when every upload of a
+		// filename was a version of it
+		fileID = uuid.NewString()
+		if ids := h.documents.filesNamed(job.Filename); len(ids) == 1 {
+			fileID = ids[0]
+		}
+	}
+	version := job.Version
+	if version == 0 {
+		var err error
+		if version, err = h.documents.reserve(fileID); err != nil {
+			return fmt.Errorf("failed to reserve version: %w", err)
+		}
+	}
+	h.jobs.setVersion(job, fileID, version)
+	return nil
+}
+
+// publishVersion records the document of a finished job and makes its chunks
+// the latest version of its file. Until then they are stored with
+// latest=false and hidden from search. A job that finishes after a job for a
+// newer version of the same file only records its version and leaves the
+// newer one latest. In replace mode every other version is removed once the
+// job's version is the latest.
+func (h *Handler) publishVersion(ctx context.Context, job *Job, info DocumentInfo, result IngestResult) error {
+	h.documentsMu.Lock()
+	defer h.documentsMu.Unlock()
+
+	filename := job.Filename
+	previous, hasPrevious := h.documents.latest(job.FileID)
+	promote := !hasPrevious || job.Version > previous.Version
+
+	// Tagging by job also covers chunks stored before a restart
+	if err := h.store.SetMetadata(ctx, Filter{"job_id": job.ID}, map[string]interface{}{
+		"document_id": job.DocumentID,
+		"version":     job.Version,
+		"latest":      promote,
+	}); err != nil {
+		return fmt.Errorf("failed to publish version %d: %w", job.Version, err)
+	}
+	if promote && hasPrevious && previous.ID != job.DocumentID {
+		if err := h.store.SetMetadata(ctx, Filter{"document_id": previous.ID}, map[string]interface{}{"latest": false}); err != nil {
+			return fmt.Errorf("failed to retire version %d: %w", previous.Version, err)
+		}
+	}
+	if err := h.documents.add(Document{
+		ID:             job.DocumentID,
+		FileID:         job.FileID,
+		Filename:       filename,
+		Version:        job.Version,
+		ContentHash:    job.ContentHash,
+		ContentType:    job.ContentType,
+		Size:           job.Size,
+		Pages:          result.PagesTotal,
+		Chunks:         result.ChunksStored,
+		ChunkSize:      job.ChunkSize,
+		ChunkStride:    job.ChunkStride,
+		EmbeddingModel: job.EmbeddingModel,
+		UploadedBy:     job.UploadedBy,
+		JobID:          job.ID,
+		File:           job.DocumentID,
+		DocumentInfo:   info,
+		UploadedAt:     job.CreatedAt,
+	}); err != nil {
+		return fmt.Errorf("failed to record version %d: %w", job.Version, err)
+	}
+	if !promote {
+		log.Printf("[VERSION PUBLISHED] File: %s | File ID: %s | Document: %s | Version: %d | Kept version %d as latest",
+			filename, job.FileID, job.DocumentID, job.Version, previous.Version)
+		return nil
+	}
+	log.Printf("[VERSION PUBLISHED] File: %s | File ID: %s | Document: %s | Version: %d | Previous: %d",
+		filename, job.FileID, job.DocumentID, job.Version, previous.Version)
+
+	if job.OnDuplicate == DuplicateReplace {
+		removed, err := h.purgeVersionsLocked(ctx, job.FileID)
+		if err != nil {
+			return err
+		}
+		log.Printf("[DEDUP REPLACE] File: %s | Job: %s | Removed %d previous versions", filename, job.ID, removed)
+	}
+	return nil
+}
+
+// purgeVersionsLocked removes every version of a file except the latest and
+// returns how many were removed. Callers must hold h.documentsMu.
+func (h *Handler) purgeVersionsLocked(ctx context.Context, fileID string) (int, error) {
+	versions, _ := h.documents.list(fileID)
+	removed := 0
+	for _, v := range versions {
+		if v.Latest {
+			continue
+		}
+		if err := h.deleteVersionLocked(ctx, v); err != nil {
+			return removed, err
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+// deleteVersionLocked removes one version of a file with its chunks and
+// original. Callers must hold h.documentsMu.
+func (h *Handler) deleteVersionLocked(ctx context.Context, doc Document) error {
+	if err := h.store.Delete(ctx, Filter{"document_id": doc.ID}); err != nil {
+		return fmt.Errorf("failed to delete version %d: %w", doc.Version, err)
+	}
+	h.deleteOriginal(ctx, doc)
+	return h.documents.remove(doc.FileID, doc.Version)
+}
+
+// deleteOriginal removes the stored original file of a document. Failures
+// are only logged; the orphaned blob does no harm.
+func (h *Handler) deleteOriginal(ctx context.Context, doc Document) {
+	if doc.File == "" {
+		return
+	}
+	if err := h.blobs.Delete(ctx, doc.File); err != nil {
+		log.Printf("[BLOB ERROR] File: %s | Document: %s | Failed to delete original: %v", doc.Filename, doc.ID, err)
+	}
+}
+
+// HandleFile serves the versions of an uploaded file. {file} is a file ID,
+// or a filename as long as only one file is called that:
+//
+//	DELETE /api/files/{file}                         delete every version
+//	GET    /api/files/{file}/versions                list versions
+//	DELETE /api/files/{file}/versions                purge all but the latest
+//	DELETE /api/files/{file}/versions/{v}            delete an older version
+//	POST   /api/files/{file}/versions/{v}/rollback   make v the latest again
+func (h *Handler) HandleFile(w http.ResponseWriter, r *http.Request) {
+	ref, rest, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/api/files/"), "/")
+	if ref == "" {
+		http.Error(w, "File ID or filename required", http.StatusBadRequest)
+		return
+	}
+	fileID, ok := h.resolveFile(w, ref)
+	if !ok {
+		return
+	}
+
+	if rest == "" {
+		if r.Method != http.MethodDelete {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		h.deleteFile(w, r, fileID)
+		return
+	}
+
+	rest, ok = strings.CutPrefix(rest, "versions")
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	if rest == "" {
+		switch r.Method {
+		case http.MethodGet:
+			h.listVersions(w, fileID)
+		case http.MethodDelete:
+			h.purgeVersions(w, r, fileID)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+		return
+	}
+
+	v, action, _ := strings.Cut(strings.TrimPrefix(rest, "/"), "/")
+	version, err := strconv.Atoi(v)
+	if err != nil || version <= 0 {
+		http.Error(w, fmt.Sprintf("invalid version %q", v), http.StatusBadRequest)
+		return
+	}
+	switch {
+	case action == "" && r.Method == http.MethodDelete:
+		h.deleteVersion(w, r, fileID, version)
+	case action == "rollback" && r.Method == http.MethodPost:
+		h.rollbackVersion(w, r, fileID, version)
+	case action == "" || action == "rollback":
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// resolveFile returns the ID of the file ref names: a file ID, or else a
+// filename that only one file has. Otherwise it answers 404, or 409 listing
+// the candidates when several files share the filename.
+func (h *Handler) resolveFile(w http.ResponseWriter, ref string) (string, bool) {
+	if h.documents.hasFile(ref) {
+		return ref, true
+	}
+	ids := h.documents.filesNamed(ref)
+	switch len(ids) {
+	case 0:
+		http.Error(w, errFileNotFound.Error(), http.StatusNotFound)
+	case 1:
+		return ids[0], true
+	default:
+		sort.Strings(ids)
+		http.Error(w, fmt.Sprintf("%d files are called %q, name one by its file ID: %s", len(ids), ref, strings.Join(ids, ", ")), http.StatusConflict)
+	}
+	return "", false
+}
+
+func (h *Handler) deleteFile(w http.ResponseWriter, r *http.Request, fileID string) {
+	h.documentsMu.Lock()
+	defer h.documentsMu.Unlock()
+
+	versions, ok := h.documents.list(fileID)
+	if !ok {
+		http.Error(w, errFileNotFound.Error(), http.StatusNotFound)
+		return
+	}
+	filename := versions[len(versions)-1].Filename
+	log.Printf("Deleting file: %s (%s)", filename, fileID)
+
+	// A job still ingesting a new version would publish it into the
+	// deleted file; cancelled jobs roll back their own chunks
+	cancelled, err := h.jobs.CancelMatching(func(job *Job) bool { return job.FileID == fileID })
+	if err != nil {
+		http.Error(w, "A new version of the file is being published, try again when its job has finished", http.StatusConflict)
+		return
+	}
+	if cancelled > 0 {
+		log.Printf("[JOB CANCEL REQUESTED] File: %s | File ID: %s | Cancelled %d unfinished jobs", filename, fileID, cancelled)
+	}
+
+	for _, doc := range versions {
+		if err := h.store.Delete(r.Context(), Filter{"document_id": doc.ID}); err != nil {
+			http.Error(w, fmt.Sprintf("failed to delete: %v", err), http.StatusInternalServerError)
+			return
+		}
+		h.deleteOriginal(r.Context(), doc)
+	}
+	if err := h.documents.removeFile(fileID); err != nil {
+		log.Printf("[VERSION ERROR] File: %s | Failed to forget versions: %v", filename, err)
+	}
+
+	log.Printf("Successfully deleted file: %s (%s)", filename, fileID)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":   "deleted",
+		"file_id":  fileID,
+		"filename": filename,
+	})
+}
+
+func (h *Handler) listVersions(w http.ResponseWriter, fileID string) {
+	versions, ok := h.documents.list(fileID)
+	if !ok {
+		http.Error(w, errFileNotFound.Error(), http.StatusNotFound)
+		return
+	}
+	latest, _ := h.documents.latest(fileID)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"file_id":  fileID,
+		"filename": latest.Filename,
+		"latest":   latest.Version,
+		"versions": versions,
+	})
+}
+
+func (h *Handler) purgeVersions(w http.ResponseWriter, r *http.Request, fileID string) {
+	h.documentsMu.Lock()
+	defer h.documentsMu.Unlock()
+
+	latest, ok := h.documents.latest(fileID)
+	if !ok {
+		http.Error(w, errFileNotFound.Error(), http.StatusNotFound)
+		return
+	}
+	removed, err := h.purgeVersionsLocked(r.Context(), fileID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("[VERSION PURGE] File: %s | File ID: %s | Removed %d old versions", latest.Filename, fileID, removed)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":   "purged",
+		"file_id":  fileID,
+		"filename": latest.Filename,
+		"removed":  removed,
+	})
+}
+
+// findVersion returns the given version of a file.
+func (h *Handler) findVersion(fileID string, version int) (Document, bool) {
+	versions, _ := h.documents.list(fileID)
+	for _, v := range versions {
+		if v.Version == version {
+			return v, true
+		}
+	}
+	return Document{}, false
+}
+
+func (h *Handler) deleteVersion(w http.ResponseWriter, r *http.Request, fileID string, version int) {
+	h.documentsMu.Lock()
+	defer h.documentsMu.Unlock()
+
+	doc, found := h.findVersion(fileID, version)
+	if !found {
+		http.Error(w, errVersionNotFound.Error(), http.StatusNotFound)
+		return
+	}
+	if doc.Latest {
+		http.Error(w, "cannot delete the latest version; roll back to another version or delete the file", http.StatusConflict)
+		return
+	}
+	if err := h.deleteVersionLocked(r.Context(), doc); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("[VERSION DELETE] File: %s | File ID: %s | Version: %d", doc.Filename, fileID, version)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":   "deleted",
+		"file_id":  fileID,
+		"filename": doc.Filename,
+		"version":  version,
+	})
+}
+
+func (h *Handler) rollbackVersion(w http.ResponseWriter, r *http.Request, fileID string, version int) {
+	h.documentsMu.Lock()
+	defer h.documentsMu.Unlock()
+
+	doc, found := h.findVersion(fileID, version)
+	if !found {
+		http.Error(w, errVersionNotFound.Error(), http.StatusNotFound)
+		return
+	}
+	if !doc.Latest {
+		if err := h.setLatestLocked(r.Context(), doc); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":   "rolled back",
+		"file_id":  fileID,
+		"filename": doc.Filename,
+		"latest":   version,
+	})
+}
+
+// setLatestLocked makes an existing version the latest one of its file.
+// Callers must hold h.documentsMu.
+func (h *Handler) setLatestLocked(ctx context.Context, doc Document) error {
+	previous, hasPrevious := h.documents.latest(doc.FileID)
+	if hasPrevious && previous.ID == doc.ID {
+		return nil
+	}
+	if err := h.store.SetMetadata(ctx, Filter{"document_id": doc.ID}, map[string]interface{}{"latest": true}); err != nil {
+		return fmt.Errorf("failed to roll back: %w", err)
+	}
+	if hasPrevious {
+		if err := h.store.SetMetadata(ctx, Filter{"document_id": previous.ID}, map[string]interface{}{"latest": false}); err != nil {
+			return fmt.Errorf("failed to roll back: %w", err)
+		}
+	}
+	if err := h.documents.setLatest(doc.FileID, doc.Version); err != nil {
+		return fmt.Errorf("failed to record rollback: %w", err)
+	}
+	log.Printf("[VERSION ROLLBACK] File: %s | File ID: %s | Version: %d | Previous: %d", doc.Filename, doc.FileID, doc.Version, previous.Version)
+	return nil
+}
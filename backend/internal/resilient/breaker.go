@@ -0,0 +1,78 @@
+package resilient
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned without contacting the service while its
+// circuit breaker is open.
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// breaker is a consecutive-failure circuit breaker. After threshold failures
+// in a row it rejects calls for cooldown, then lets a single trial call
+// through: success closes the circuit again, failure reopens it.
+type breaker struct {
+	threshold int
+	cooldown  time.Duration
+
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time // zero while closed
+	trial     bool      // a half-open trial call is in flight
+}
+
+func newBreaker(threshold int, cooldown time.Duration) *breaker {
+	return &breaker{threshold: threshold, cooldown: cooldown}
+}
+
+// allow reports whether a call may proceed.
+func (b *breaker) allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.openUntil.IsZero() {
+		return nil
+	}
+	if time.Now().Before(b.openUntil) || b.trial {
+		return ErrCircuitOpen
+	}
+	b.trial = true
+	return nil
+}
+
+// success closes the circuit. It reports whether the circuit was open.
+func (b *breaker) success() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	wasOpen := !b.openUntil.IsZero()
+	b.failures = 0
+	b.openUntil = time.Time{}
+	b.trial = false
+	return wasOpen
+}
+
+// failure records a failed call. It reports whether the circuit opened as
+// a result.
+func (b *breaker) failure() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures++
+	if b.trial || (b.openUntil.IsZero() && b.failures >= b.threshold) {
+		b.trial = false
+		b.openUntil = time.Now().Add(b.cooldown)
+		return true
+	}
+	return false
+}
+
+// release ends a half-open trial whose outcome says nothing about the
+// service, such as a call cancelled by its caller.
+func (b *breaker) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.trial = false
+}
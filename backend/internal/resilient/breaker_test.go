@@ -0,0 +1,81 @@
+package resilient
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// expire ends the cooldown of an open breaker without waiting for it.
+func expire(b *breaker) {
+	b.mu.Lock()
+	b.openUntil = time.Now().Add(-time.Second)
+	b.mu.Unlock()
+}
+
+func TestBreakerOpensAfterThreshold(t *testing.T) {
+	b := newBreaker(3, time.Hour)
+	for i := 1; i < 3; i++ {
+		if b.failure() {
+			t.Fatalf("circuit opened after %d failures, want 3", i)
+		}
+		if err := b.allow(); err != nil {
+			t.Fatalf("allow after %d failures = %v, want nil", i, err)
+		}
+	}
+	// A success in between starts the count again
+	b.success()
+	b.failure()
+	b.failure()
+	if err := b.allow(); err != nil {
+		t.Fatalf("allow after a success and 2 failures = %v, want nil", err)
+	}
+	if !b.failure() {
+		t.Fatal("circuit did not open after 3 failures in a row")
+	}
+	if err := b.allow(); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("allow while open = %v, want ErrCircuitOpen", err)
+	}
+}
+
+func TestBreakerHalfOpen(t *testing.T) {
+	b := newBreaker(1, time.Hour)
+	b.failure()
+	expire(b)
+
+	// Only one trial call is let through once the cooldown is over
+	if err := b.allow(); err != nil {
+		t.Fatalf("trial call rejected: %v", err)
+	}
+	if err := b.allow(); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("second call during the trial = %v, want ErrCircuitOpen", err)
+	}
+
+	// A failed trial opens the circuit for another cooldown
+	if !b.failure() {
+		t.Fatal("failed trial did not reopen the circuit")
+	}
+	if err := b.allow(); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("allow after a failed trial = %v, want ErrCircuitOpen", err)
+	}
+
+	// A released trial lets the next call try instead
+	expire(b)
+	if err := b.allow(); err != nil {
+		t.Fatalf("trial call rejected: %v", err)
+	}
+	b.release()
+	if err := b.allow(); err != nil {
+		t.Fatalf("trial call after a release rejected: %v", err)
+	}
+
+	// A successful trial closes it
+	if !b.success() {
+		t.Error("success did not report that the circuit was open")
+	}
+	for i := 0; i < 2; i++ {
+		if err := b.allow(); err != nil {
+			t.Errorf("allow after closing = %v, want nil", err)
+		}
+	}
+}
@@ -0,0 +1,202 @@
+// Package resilient provides an HTTP client for calls to backend services
+// (Ollama, Chroma, ...) that retries transient failures with jittered
+// exponential backoff, bounds every attempt with a timeout and stops calling
+// a failing service for a while through a circuit breaker.
+package resilient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net/http"
+	"time"
+)
+
+// Config controls retries, timeouts and the circuit breaker of a Client.
+type Config struct {
+	MaxAttempts      int           // attempts per call, including the first
+	BaseDelay        time.Duration // backoff before the first retry, doubled for each further retry
+	MaxDelay         time.Duration // upper bound for a single backoff
+	Timeout          time.Duration // limit for one attempt, including reading the response body
+	HeaderTimeout    time.Duration // if set, limits one attempt only until the response headers arrive, instead of Timeout
+	FailureThreshold int           // consecutive failures that open the circuit
+	Cooldown         time.Duration // how long an open circuit rejects calls
+}
+
+// DefaultConfig returns the settings used when none are configured.
+func DefaultConfig() Config {
+	return Config{
+		MaxAttempts:      4,
+		BaseDelay:        500 * time.Millisecond,
+		MaxDelay:         10 * time.Second,
+		Timeout:          2 * time.Minute,
+		FailureThreshold: 5,
+		Cooldown:         30 * time.Second,
+	}
+}
+
+// Client sends requests to one service. Create one Client per service so
+// each has its own circuit breaker.
+type Client struct {
+	name    string
+	cfg     Config
+	http    *http.Client
+	breaker *breaker
+}
+
+// New creates a client for the service called name, which is used in logs
+// and errors.
+func New(name string, cfg Config) *Client {
+	client := http.DefaultClient
+	if cfg.HeaderTimeout > 0 {
+		// Bodies are streamed for as long as they take, so large uploads
+		// and downloads are not cut off
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.ResponseHeaderTimeout = cfg.HeaderTimeout
+		client = &http.Client{Transport: transport}
+	}
+	return &Client{
+		name:    name,
+		cfg:     cfg,
+		http:    client,
+		breaker: newBreaker(cfg.FailureThreshold, cfg.Cooldown),
+	}
+}
+
+// Do sends req, retrying network errors, timeouts, 429 and 5xx responses.
+// Requests with a body are only retried if it can be replayed (GetBody is
+// set, as it is for bytes and strings readers). When every attempt gets a
+// retryable status the last response is returned so callers can report it;
+// other failures are returned as errors. While the circuit is open Do fails
+// with ErrCircuitOpen without sending anything.
+func (c *Client) Do(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	attempts := c.cfg.MaxAttempts
+	if req.Body != nil && req.GetBody == nil {
+		attempts = 1
+	}
+
+	var lastErr error
+	for attempt := 1; ; attempt++ {
+		if err := c.breaker.allow(); err != nil {
+			if lastErr != nil {
+				return nil, fmt.Errorf("%s: %w (last error: %v)", c.name, err, lastErr)
+			}
+			return nil, fmt.Errorf("%s: %w", c.name, err)
+		}
+
+		resp, err := c.attempt(req, attempt)
+		if ctx.Err() != nil {
+			c.breaker.release()
+			if resp != nil {
+				resp.Body.Close()
+			}
+			return nil, ctx.Err()
+		}
+
+		if err == nil && !retryableStatus(resp.StatusCode) {
+			if c.breaker.success() {
+				log.Printf("[CIRCUIT CLOSED] Service: %s | Calls resumed", c.name)
+			}
+			return resp, nil
+		}
+
+		if err != nil {
+			lastErr = err
+		} else {
+			lastErr = fmt.Errorf("status %d", resp.StatusCode)
+		}
+		if c.breaker.failure() {
+			log.Printf("[CIRCUIT OPEN] Service: %s | Rejecting calls for %s after: %v", c.name, c.cfg.Cooldown, lastErr)
+		}
+
+		if attempt >= attempts {
+			if err != nil {
+				return nil, fmt.Errorf("%s: giving up after %d attempts: %w", c.name, attempt, err)
+			}
+			return resp, nil
+		}
+		if resp != nil {
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+
+		delay := c.backoff(attempt)
+		log.Printf("[HTTP RETRY] Service: %s | %s %s | Attempt %d/%d failed: %v | Retrying in %s",
+			c.name, req.Method, req.URL.Path, attempt, attempts, lastErr, delay.Round(time.Millisecond))
+
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// attempt sends one copy of req bounded by the per-attempt timeout. The
+// timeout stays in force until the response body is closed, unless the
+// client only has a HeaderTimeout.
+func (c *Client) attempt(req *http.Request, n int) (*http.Response, error) {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	if c.cfg.HeaderTimeout > 0 {
+		ctx, cancel = context.WithCancel(req.Context())
+	} else {
+		ctx, cancel = context.WithTimeout(req.Context(), c.cfg.Timeout)
+	}
+
+	r := req.Clone(ctx)
+	if n > 1 && req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			cancel()
+			return nil, fmt.Errorf("failed to replay request body: %w", err)
+		}
+		r.Body = body
+	}
+
+	resp, err := c.http.Do(r)
+	if err != nil {
+		cancel()
+		if errors.Is(err, context.DeadlineExceeded) {
+			return nil, fmt.Errorf("attempt timed out after %s: %w", c.cfg.Timeout, err)
+		}
+		return nil, err
+	}
+	resp.Body = &cancelOnClose{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+// backoff returns a random delay in [0, min(MaxDelay, BaseDelay*2^(attempt-1))].
+func (c *Client) backoff(attempt int) time.Duration {
+	d := c.cfg.BaseDelay
+	for i := 1; i < attempt && d < c.cfg.MaxDelay; i++ {
+		d *= 2
+	}
+	if d > c.cfg.MaxDelay {
+		d = c.cfg.MaxDelay
+	}
+	if d <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(d) + 1))
+}
+
+func retryableStatus(code int) bool {
+	return code == http.StatusTooManyRequests || code >= 500
+}
+
+// cancelOnClose releases the attempt's timeout once the body is closed.
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelOnClose) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
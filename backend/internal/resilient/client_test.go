@@ -0,0 +1,224 @@
+package resilient
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testConfig retries quickly and keeps the circuit closed.
+func testConfig() Config {
+	return Config{
+		MaxAttempts:      3,
+		BaseDelay:        time.Millisecond,
+		MaxDelay:         2 * time.Millisecond,
+		Timeout:          time.Second,
+		FailureThreshold: 100,
+		Cooldown:         time.Minute,
+	}
+}
+
+// statusServer answers the n-th call (from 1) with statuses[n-1], and every
+// call after the last with the last status. It counts the calls in calls.
+func statusServer(t *testing.T, calls *atomic.Int32, statuses ...int) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := int(calls.Add(1))
+		w.WriteHeader(statuses[min(n, len(statuses))-1])
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func get(t *testing.T, c *Client, url string) (*http.Response, error) {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := c.Do(req)
+	if err == nil {
+		t.Cleanup(func() { resp.Body.Close() })
+	}
+	return resp, err
+}
+
+func TestBackoff(t *testing.T) {
+	c := New("test", Config{BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second})
+	for attempt, limit := range map[int]time.Duration{
+		1: 100 * time.Millisecond,
+		2: 200 * time.Millisecond,
+		3: 400 * time.Millisecond,
+		4: 800 * time.Millisecond,
+		5: time.Second,
+		9: time.Second,
+	} {
+		for i := 0; i < 100; i++ {
+			if d := c.backoff(attempt); d < 0 || d > limit {
+				t.Fatalf("backoff(%d) = %s, want at most %s", attempt, d, limit)
+			}
+		}
+	}
+	if d := New("test", Config{}).backoff(3); d != 0 {
+		t.Errorf("backoff without a base delay = %s, want 0", d)
+	}
+}
+
+func TestDoRetries(t *testing.T) {
+	tests := []struct {
+		name      string
+		statuses  []int
+		want      int
+		wantCalls int32
+	}{
+		{"5xx is retried", []int{http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusOK}, http.StatusOK, 3},
+		{"429 is retried", []int{http.StatusTooManyRequests, http.StatusOK}, http.StatusOK, 2},
+		{"last response is returned", []int{http.StatusInternalServerError}, http.StatusInternalServerError, 3},
+		{"4xx is not retried", []int{http.StatusNotFound, http.StatusOK}, http.StatusNotFound, 1},
+		{"success is not retried", []int{http.StatusOK}, http.StatusOK, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls atomic.Int32
+			srv := statusServer(t, &calls, tt.statuses...)
+			resp, err := get(t, New("test", testConfig()), srv.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != tt.want {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.want)
+			}
+			if n := calls.Load(); n != tt.wantCalls {
+				t.Errorf("%d calls, want %d", n, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestDoRetriesTransportErrors(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			// Drop the connection without answering
+			conn, _, err := w.(http.Hijacker).Hijack()
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			conn.Close()
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	resp, err := get(t, New("test", testConfig()), srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK || calls.Load() != 2 {
+		t.Errorf("status %d after %d calls, want 200 after 2", resp.StatusCode, calls.Load())
+	}
+
+	// Once every attempt fails the error says so
+	srv.Close()
+	if _, err := get(t, New("test", testConfig()), srv.URL); err == nil || !strings.Contains(err.Error(), "giving up after 3 attempts") {
+		t.Errorf("error = %v, want giving up after 3 attempts", err)
+	}
+}
+
+func TestDoReplaysBody(t *testing.T) {
+	var calls atomic.Int32
+	var bodies []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+		if calls.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+	c := New("test", testConfig())
+
+	// bytes.Reader bodies get a GetBody, so they are sent again in full
+	req, _ := http.NewRequest(http.MethodPost, srv.URL, bytes.NewReader([]byte("payload")))
+	resp, err := c.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || len(bodies) != 2 || bodies[0] != "payload" || bodies[1] != "payload" {
+		t.Errorf("status %d with bodies %q, want 200 after sending payload twice", resp.StatusCode, bodies)
+	}
+
+	// Without GetBody the body cannot be replayed, so there is one attempt
+	calls.Store(0)
+	bodies = nil
+	req, _ = http.NewRequest(http.MethodPost, srv.URL, io.NopCloser(strings.NewReader("payload")))
+	resp, err = c.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable || len(bodies) != 1 {
+		t.Errorf("status %d after %d calls, want 503 after 1", resp.StatusCode, len(bodies))
+	}
+}
+
+func TestDoCircuitOpen(t *testing.T) {
+	var calls atomic.Int32
+	srv := statusServer(t, &calls, http.StatusInternalServerError)
+	cfg := testConfig()
+	cfg.MaxAttempts = 1
+	cfg.FailureThreshold = 2
+	c := New("test", cfg)
+
+	for i := 0; i < 2; i++ {
+		if _, err := get(t, c, srv.URL); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := get(t, c, srv.URL); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("error = %v, want ErrCircuitOpen", err)
+	}
+	if n := calls.Load(); n != 2 {
+		t.Errorf("%d calls, want 2: an open circuit must not send anything", n)
+	}
+}
+
+func TestDoTimeout(t *testing.T) {
+	// The headers arrive at once but the body takes longer than Timeout
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		time.Sleep(100 * time.Millisecond)
+		io.WriteString(w, "body")
+	}))
+	defer srv.Close()
+	cfg := testConfig()
+	cfg.Timeout = 20 * time.Millisecond
+
+	resp, err := get(t, New("test", cfg), srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.ReadAll(resp.Body); err == nil {
+		t.Error("reading the body outlived the attempt's timeout")
+	}
+
+	// A HeaderTimeout leaves reading the body unbounded
+	cfg.HeaderTimeout = cfg.Timeout
+	resp, err = get(t, New("test", cfg), srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body, err := io.ReadAll(resp.Body); err != nil || string(body) != "body" {
+		t.Errorf("body = %q, %v, want %q", body, err, "body")
+	}
+}
@@ -2,11 +2,57 @@
 
 const API_BASE_URL = "/api";
 
+export interface IngestResult {
+    duplicate_of?: string;
+    duplicate_id?: string;
+    pages_total: number;
+    pages_skipped?: { page: number; reason: string }[];
+    chunks_created: number;
+    chunks_embedded: number;
+    chunks_stored: number;
+    chunks_failed: number;
+    failures?: { chunk: number; stage: "embed" | "store"; reason: string }[];
+}
+
 export interface ProcessingResult {
     status: string;
     filename: string;
     chunkSize: number;
     chunkStride: number;
+    document_id?: string;
+    file_id?: string;
+    version?: number;
+    result?: IngestResult;
+}
+
+export interface UploadJob {
+    job_id: string;
+    document_id: string;
+    file_id: string;
+    status: string;
+    filename: string;
+}
+
+export interface Job {
+    id: string;
+    filename: string;
+    status: "queued" | "running" | "completed" | "failed" | "cancelled";
+    chunk_size: number;
+    chunk_stride: number;
+    embedding_model: string;
+    content_hash: string;
+    on_duplicate: "skip" | "replace" | "keep";
+    document_id?: string;
+    file_id?: string;
+    version?: number;
+    size?: number;
+    uploaded_by?: string;
+    progress?: string;
+    error?: string;
+    checkpoint: number;
+    result?: IngestResult;
+    created_at: string;
+    updated_at: string;
 }
 
 export interface SearchResult {
@@ -14,13 +60,48 @@ export interface SearchResult {
     documents: string[][];
     metadatas: any[][];
     distances: number[][];
+    sources: { [documentId: string]: StoredDocument };
+}
+
+// A registered upload; named to avoid the DOM's Document type
+export interface StoredDocument {
+    id: string;
+    file_id: string;
+    filename: string;
+    version: number;
+    latest: boolean;
+    content_hash?: string;
+    size?: number;
+    pages?: number;
+    chunks: number;
+    chunk_size?: number;
+    chunk_stride?: number;
+    embedding_model?: string;
+    uploaded_by?: string;
+    job_id?: string;
+    file?: string;
+    title?: string;
+    author?: string;
+    subject?: string;
+    created?: string;
+    url?: string;
+    uploaded_at: string;
+    updated_at: string;
+}
+
+export interface FileVersions {
+    file_id: string;
+    filename: string;
+    latest: number;
+    versions: StoredDocument[];
 }
 
 export interface StatsResult {
     total_chunks: number;
     total_files: number;
     files: string[];
-    file_chunk_counts: { [key: string]: number };
+    file_chunk_counts: { [documentId: string]: number }; // chunks of the latest version of each file
+    documents: StoredDocument[];
 }
 
 export interface OllamaModel {
@@ -44,6 +125,21 @@ async function handleResponse<T>(response: Response): Promise<T> {
     return response.json();
 }
 
+// Reads the filename out of a Content-Disposition header, preferring the
+// RFC 5987 filename* form used for non-ASCII names.
+function dispositionFilename(header: string | null): string {
+    if (!header) return "";
+    const encoded = /filename\*=(?:utf-8|UTF-8)''([^;]+)/.exec(header);
+    if (encoded) {
+        try {
+            return decodeURIComponent(encoded[1]);
+        } catch {
+            // fall through to the plain form
+        }
+    }
+    const plain = /filename="?([^";]+)"?/.exec(header);
+    return plain ? plain[1] : "";
+}
 
 const TOKEN_KEY = "gowise_token";
 
@@ -93,6 +189,30 @@ export const api = {
             signal: signal,
         });
 
+        const job = await handleResponse<UploadJob>(response);
+        console.log(`[UPLOAD QUEUED] File: ${fileName} | Job: ${job.job_id} | Timestamp: ${new Date().toISOString()}`);
+
+        try {
+            return await this.followJob(job.job_id, fileName, onProgress, signal);
+        } catch (error) {
+            // Closing the stream does not stop a background job, so cancel it explicitly
+            if (signal?.aborted) {
+                await this.cancelJob(job.job_id).catch(() => undefined);
+            }
+            throw error;
+        }
+    },
+
+    async followJob(jobId: string, fileName: string, onProgress?: (msg: string) => void, signal?: AbortSignal): Promise<ProcessingResult> {
+        const response = await fetch(`${API_BASE_URL}/jobs/${encodeURIComponent(jobId)}/stream`, {
+            headers: { ...getAuthHeader() },
+            signal: signal,
+        });
+
+        if (!response.ok) {
+            return handleResponse<ProcessingResult>(response);
+        }
+
         if (!response.body) {
             console.error(`[UPLOAD ERROR] File: ${fileName} | Error: Response body is empty`);
             throw new Error("Response body is empty");
@@ -147,16 +267,39 @@ export const api = {
             return finalResult;
         }
 
-        if (response.ok) {
-            console.error(`[UPLOAD ERROR] File: ${fileName} | Error: Upload process ended without completion status`);
-            throw new Error("Upload process ended without completion status");
-        }
+        console.error(`[UPLOAD ERROR] File: ${fileName} | Error: Upload process ended without completion status`);
+        throw new Error("Upload process ended without completion status");
+    },
+
+    async listJobs(): Promise<{ jobs: Job[] }> {
+        const response = await fetch(`${API_BASE_URL}/jobs`, {
+            headers: getAuthHeader()
+        });
+        return handleResponse<{ jobs: Job[] }>(response);
+    },
 
-        return handleResponse<ProcessingResult>(response);
+    async cancelJob(jobId: string): Promise<Job> {
+        const response = await fetch(`${API_BASE_URL}/jobs/${encodeURIComponent(jobId)}`, {
+            method: "DELETE",
+            headers: getAuthHeader()
+        });
+        return handleResponse<Job>(response);
+    },
+
+    async getJob(jobId: string): Promise<Job> {
+        const response = await fetch(`${API_BASE_URL}/jobs/${encodeURIComponent(jobId)}`, {
+            headers: getAuthHeader()
+        });
+        return handleResponse<Job>(response);
     },
 
-    async searchVectors(query: string): Promise<SearchResult> {
-        const response = await fetch(`${API_BASE_URL}/search?q=${encodeURIComponent(query)}`, {
+    async searchVectors(query: string, fileId?: string, version?: number, filters?: { author?: string; year?: number }): Promise<SearchResult> {
+        const params = new URLSearchParams({ q: query });
+        if (fileId) params.set("file_id", fileId);
+        if (version) params.set("version", String(version));
+        if (filters?.author) params.set("author", filters.author);
+        if (filters?.year) params.set("year", String(filters.year));
+        const response = await fetch(`${API_BASE_URL}/search?${params}`, {
             headers: getAuthHeader()
         });
         return handleResponse<SearchResult>(response);
@@ -177,12 +320,120 @@ export const api = {
         return handleResponse<StatsResult>(response);
     },
 
-    async deleteFile(filename: string): Promise<{ status: string; filename: string }> {
-        const response = await fetch(`${API_BASE_URL}/files/${encodeURIComponent(filename)}`, {
+    async deleteFile(fileId: string): Promise<{ status: string; file_id: string; filename: string }> {
+        const response = await fetch(`${API_BASE_URL}/files/${encodeURIComponent(fileId)}`, {
+            method: "DELETE",
+            headers: getAuthHeader()
+        });
+        return handleResponse<{ status: string; file_id: string; filename: string }>(response);
+    },
+
+    async listDocuments(filename?: string, latestOnly = false): Promise<{ documents: StoredDocument[] }> {
+        const params = new URLSearchParams();
+        if (filename) params.set("filename", filename);
+        if (latestOnly) params.set("latest", "true");
+        const query = params.toString() ? `?${params}` : "";
+        const response = await fetch(`${API_BASE_URL}/documents${query}`, {
+            headers: getAuthHeader()
+        });
+        return handleResponse<{ documents: StoredDocument[] }>(response);
+    },
+
+    async getDocument(id: string): Promise<StoredDocument> {
+        const response = await fetch(`${API_BASE_URL}/documents/${encodeURIComponent(id)}`, {
+            headers: getAuthHeader()
+        });
+        return handleResponse<StoredDocument>(response);
+    },
+
+    async makeLatest(id: string): Promise<StoredDocument> {
+        const response = await fetch(`${API_BASE_URL}/documents/${encodeURIComponent(id)}`, {
+            method: "PATCH",
+            headers: { ...getAuthHeader(), "Content-Type": "application/json" },
+            body: JSON.stringify({ latest: true })
+        });
+        return handleResponse<StoredDocument>(response);
+    },
+
+    async deleteDocument(id: string, allVersions = false): Promise<{ status: string; filename: string }> {
+        const query = allVersions ? "?all_versions=true" : "";
+        const response = await fetch(`${API_BASE_URL}/documents/${encodeURIComponent(id)}${query}`, {
             method: "DELETE",
             headers: getAuthHeader()
         });
         return handleResponse<{ status: string; filename: string }>(response);
+    },
+
+    // Opens the original file of a PDF in a new tab. The endpoint needs the
+    // auth header, so the file is fetched and shown from a blob URL. Any
+    // other format is downloaded instead: a same-origin blob of an uploaded
+    // HTML page would run its scripts with access to the stored token.
+    async openDocumentFile(id: string, page?: number): Promise<void> {
+        const tab = window.open("", "_blank");
+        try {
+            const response = await fetch(`${API_BASE_URL}/documents/${encodeURIComponent(id)}/file`, {
+                headers: getAuthHeader()
+            });
+            if (!response.ok) {
+                const text = await response.text();
+                throw new ApiError(response.status, text || response.statusText);
+            }
+            const contentType = response.headers.get("Content-Type") || "";
+            if (!contentType.startsWith("application/pdf")) {
+                tab?.close();
+                const data = await response.arrayBuffer();
+                const url = URL.createObjectURL(new Blob([data], { type: "application/octet-stream" }));
+                const link = document.createElement("a");
+                link.href = url;
+                link.download = dispositionFilename(response.headers.get("Content-Disposition")) || "download";
+                link.click();
+                setTimeout(() => URL.revokeObjectURL(url), 60_000);
+                return;
+            }
+            const data = await response.arrayBuffer();
+            const url = URL.createObjectURL(new Blob([data], { type: "application/pdf" }));
+            const target = page ? `${url}#page=${page}` : url;
+            if (tab) {
+                tab.location.href = target;
+            } else {
+                window.open(target, "_blank");
+            }
+            setTimeout(() => URL.revokeObjectURL(url), 60_000);
+        } catch (error) {
+            tab?.close();
+            throw error;
+        }
+    },
+
+    async listVersions(fileId: string): Promise<FileVersions> {
+        const response = await fetch(`${API_BASE_URL}/files/${encodeURIComponent(fileId)}/versions`, {
+            headers: getAuthHeader()
+        });
+        return handleResponse<FileVersions>(response);
+    },
+
+    async rollbackVersion(fileId: string, version: number): Promise<{ status: string; file_id: string; filename: string; latest: number }> {
+        const response = await fetch(`${API_BASE_URL}/files/${encodeURIComponent(fileId)}/versions/${version}/rollback`, {
+            method: "POST",
+            headers: getAuthHeader()
+        });
+        return handleResponse<{ status: string; file_id: string; filename: string; latest: number }>(response);
+    },
+
+    async deleteVersion(fileId: string, version: number): Promise<{ status: string; file_id: string; filename: string; version: number }> {
+        const response = await fetch(`${API_BASE_URL}/files/${encodeURIComponent(fileId)}/versions/${version}`, {
+            method: "DELETE",
+            headers: getAuthHeader()
+        });
+        return handleResponse<{ status: string; file_id: string; filename: string; version: number }>(response);
+    },
+
+    async purgeVersions(fileId: string): Promise<{ status: string; file_id: string; filename: string; removed: number }> {
+        const response = await fetch(`${API_BASE_URL}/files/${encodeURIComponent(fileId)}/versions`, {
+            method: "DELETE",
+            headers: getAuthHeader()
+        });
+        return handleResponse<{ status: string; file_id: string; filename: string; removed: number }>(response);
     }
 };
 